@@ -0,0 +1,82 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//readEnding reads the numbers of a variant ending, written after '[' like "[1,3" or right after a barline like "|2".
+//It returns the numbers and the ending as written.
+//ending ::= ['['], endingRange, {',', endingRange};
+//endingRange ::= DIGIT+, ['-', DIGIT+];
+func (d *Decoder) readEnding() ([]int, string, error) {
+	var written []byte
+	if b, err := d.r.Peek(1); err == nil && b[0] == '[' {
+		d.r.ReadByte()
+		written = append(written, '[')
+	}
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil || (b[0] < '0' || b[0] > '9') && b[0] != ',' && b[0] != '-' {
+			break
+		}
+		d.r.ReadByte()
+		written = append(written, b[0])
+	}
+	numbers, err := parseEnding(strings.TrimPrefix(string(written), "["))
+	return numbers, string(written), err
+}
+
+//parseEnding returns the numbers of an ending like "1,3" or "2-4", which are 1 and 3 or 2, 3 and 4.
+func parseEnding(text string) ([]int, error) {
+	var numbers []int
+	for _, part := range strings.Split(text, ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, errors.Errorf("ending %q not properly formatted", text)
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = strconv.Atoi(bounds[1])
+			if err != nil || last < first {
+				return nil, errors.Errorf("ending %q not properly formatted", text)
+			}
+		}
+		for number := first; number <= last; number++ {
+			numbers = append(numbers, number)
+		}
+	}
+	return numbers, nil
+}
+
+//setBarline sets what the barline between two consecutive measures tells about them.
+//The invisible barline "[|]" and the dotted barline ".|" only separate the measures.
+func setBarline(prev, next *Measure, barline string) {
+	next.Barline = barline
+	if barline == "[|]" || strings.HasPrefix(barline, ".") {
+		return
+	}
+	prev.RepeatEnd = strings.HasPrefix(barline, ":")
+	prev.ThickEnd = strings.Contains(barline, "|]")
+	next.RepeatStart = len(barline) > 1 && strings.HasSuffix(barline, ":")
+	next.ThickStart = strings.Contains(barline, "[|")
+	next.BarlineStart = strings.Contains(barline, "||")
+}
+
+//formatEnding returns the variant ending at the start of a measure, as written after its barline.
+func formatEnding(m *Measure) string {
+	if m.EndingNotation != "" {
+		return m.EndingNotation
+	}
+	if len(m.Ending) == 0 {
+		return ""
+	}
+	numbers := make([]string, len(m.Ending))
+	for i, number := range m.Ending {
+		numbers[i] = strconv.Itoa(number)
+	}
+	return "[" + strings.Join(numbers, ",")
+}
@@ -0,0 +1,87 @@
+package abc
+
+import (
+	"regexp"
+	"strings"
+)
+
+//ChordSymbol is a guitar chord written in quotes in front of a note, like "Am7/G".
+type ChordSymbol struct {
+	//Root is the note the chord is built on, like "A", "F#" or "Bb".
+	Root string `json:"root"`
+	//Quality is "m", "maj", "min", "dim", "aug", "sus", "M", "+", "-" or "o", or empty for a major chord.
+	Quality string `json:"quality,omitempty"`
+	//Extensions are the added and altered notes following the quality, like "7", "9" or "7b5".
+	Extensions string `json:"extensions,omitempty"`
+	//Bass is the bass note of an inverted chord, like "G" in "Am7/G".
+	Bass string `json:"bass,omitempty"`
+}
+
+//Annotation is a text written in quotes in front of a note, with its placement.
+//The placement is '^' above, '_' below, '<' left of, '>' right of the note or '@' at a free position.
+type Annotation struct {
+	Placement string `json:"placement,omitempty"`
+	Text      string `json:"text"`
+}
+
+//chord qualities, with the longest ones first.
+var chordQualities = []string{"maj", "min", "dim", "aug", "sus", "m", "M", "+", "-", "o"}
+
+var chordNote = regexp.MustCompile(`^[A-G][#b]?$`)
+var chordExtensions = regexp.MustCompile(`^([#b+\-]?[0-9]+|add[0-9]+|sus[0-9]*|maj[0-9]*|alt|\(|\)|,)*$`)
+
+//parseChordSymbol reads a chord symbol like "C", "F#m", "Bbmaj7", "Am7/G" or "C6/9".
+//It returns false if the text is not a chord symbol.
+//chordSymbol ::= root, [quality], {extension}, ['/', root];
+func parseChordSymbol(text string) (ChordSymbol, bool) {
+	symbol := ChordSymbol{}
+	if len(text) == 0 || text[0] < 'A' || text[0] > 'G' {
+		return symbol, false
+	}
+	symbol.Root = text[0:1]
+	text = text[1:]
+	if strings.HasPrefix(text, "#") || strings.HasPrefix(text, "b") {
+		symbol.Root += text[0:1]
+		text = text[1:]
+	}
+	if slash := strings.LastIndexByte(text, '/'); slash != -1 && chordNote.MatchString(text[slash+1:]) {
+		symbol.Bass = text[slash+1:]
+		text = text[:slash]
+	}
+	for _, quality := range chordQualities {
+		if strings.HasPrefix(text, quality) {
+			symbol.Quality = quality
+			text = text[len(quality):]
+			break
+		}
+	}
+	if !chordExtensions.MatchString(strings.Replace(text, "/", "", -1)) {
+		return ChordSymbol{}, false
+	}
+	symbol.Extensions = text
+	return symbol, true
+}
+
+//String returns the chord symbol as written between the quotes.
+func (c *ChordSymbol) String() string {
+	symbol := c.Root + c.Quality + c.Extensions
+	if c.Bass != "" {
+		symbol += "/" + c.Bass
+	}
+	return symbol
+}
+
+//parseQuoted reads the text between the quotes in front of a note,
+//which is an annotation if it starts with a placement and a chord symbol otherwise.
+//Text that is not a chord symbol is kept as an annotation without placement.
+func (a *Attached) parseQuoted(text string) {
+	if text != "" && strings.IndexByte("^_<>@", text[0]) != -1 {
+		a.Annotations = append(a.Annotations, Annotation{Placement: text[0:1], Text: text[1:]})
+		return
+	}
+	if symbol, ok := parseChordSymbol(text); ok {
+		a.ChordSymbol = &symbol
+		return
+	}
+	a.Annotations = append(a.Annotations, Annotation{Text: text})
+}
@@ -3,8 +3,10 @@ package abc
 import (
 	"bufio"
 	"bytes"
-	"fmt"
+	"io"
+	"reflect"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -16,65 +18,88 @@ type Tune struct {
 	ReferenceNumber uint64 `json:"referenceNumber,omitempty"`
 	Title           string `json:"title"`
 
-	Area           string `json:"area,omitempty"`
-	Book           string `json:"book,omitempty"`
-	Composer       string `json:"composer,omitempty"`
-	Discography    string `json:"discography,omitempty"`
-	FileURL        string `json:"fileURL,omitempty"`
-	Group          string `json:"group,omitempty"`
-	History        string `json:"history,omitempty"`
-	Key            string `json:"key,omitempty"`
-	UnitNoteLength string `json:"unitNoteLength,omitempty"`
-	MeterTop       uint64 `json:"meterTop,omitempty"`
-	MeterBottom    uint64 `json:"meterBottom,omitempty"`
-	Macro          string `json:"macro,omitempty"`
-	NoteText       string `json:"notes,omitempty"`
-	Origin         string `json:"origin,omitempty"`
-	Parts          string `json:"parts,omitempty"`
-	Tempo          string `json:"tempo,omitempty"`
-	Rhythm         string `json:"rhythm,omitempty"`
-	Remark         string `json:"remark,omitempty"`
-	Source         string `json:"source,omitempty"`
-	UserDefined    string `json:"userDefined,omitempty"`
-	Voice          string `json:"voice,omitempty"`
-	Words          string `json:"words,omitempty"`
-	Transcription  string `json:"transcription,omitempty"`
+	Area           string       `json:"area,omitempty"`
+	Book           string       `json:"book,omitempty"`
+	Composer       string       `json:"composer,omitempty"`
+	Discography    string       `json:"discography,omitempty"`
+	FileURL        string       `json:"fileURL,omitempty"`
+	Group          string       `json:"group,omitempty"`
+	History        string       `json:"history,omitempty"`
+	Key            Key          `json:"key"`
+	UnitNoteLength Fraction     `json:"unitNoteLength"`
+	Meter          *Meter       `json:"meter,omitempty"`
+	MeterTop       uint64       `json:"meterTop,omitempty"`
+	MeterBottom    uint64       `json:"meterBottom,omitempty"`
+	Macro          []Macro      `json:"macro,omitempty"`
+	NoteText       string       `json:"notes,omitempty"`
+	Origin         string       `json:"origin,omitempty"`
+	Parts          PartOrder    `json:"parts,omitempty"`
+	Tempo          *Tempo       `json:"tempo,omitempty"`
+	Rhythm         string       `json:"rhythm,omitempty"`
+	Remark         string       `json:"remark,omitempty"`
+	Source         string       `json:"source,omitempty"`
+	UserDefined    []UserSymbol `json:"userDefined,omitempty"`
+	Words          string       `json:"words,omitempty"`
+	Transcription  string       `json:"transcription,omitempty"`
 
 	Measures []Measure
+	//Voices holds the music of each voice in a tune with V: fields.
+	//Music that is not in any voice is kept in Measures.
+	Voices []Voice `json:"voices,omitempty"`
+
+	//Partial is set when the tune was decoded in lenient mode and not everything could be decoded.
+	Partial bool `json:"partial,omitempty"`
 }
 
 //Decoder contains structured ABC-file information after decoding.
 type Decoder struct {
-	r                    *bufio.Reader
+	r                    *positionReader
 	fileCheck            bool
 	inFileHeader         bool
 	tuneHeaderDone       bool
 	lastInformationField string
-	halveDuration        bool
-	doubleDuration       bool
+	started              bool
+	tune                 *Tune
+	voiceState                                 //state of the voice that is being decoded
+	voice                string                //ID of the voice that is being decoded
+	voiceStates          map[string]voiceState //state of the other voices, by ID
+	symbols              map[byte]string       //definitions of the single characters that stand for a decoration
 
 	Version float32 `json:"abc-version,omitempty"`
 
-	Area           string `json:"area,omitempty"`
-	Book           string `json:"book,omitempty"`
-	Composer       string `json:"composer,omitempty"`
-	Discography    string `json:"discography,omitempty"`
-	FileURL        string `json:"fileURL,omitempty"`
-	Group          string `json:"group,omitempty"`
-	History        string `json:"history,omitempty"`
-	UnitNoteLength string `json:"unitNoteLength,omitempty"`
-	MeterTop       uint64 `json:"meterTop,omitempty"`
-	MeterBottom    uint64 `json:"meterBottom,omitempty"`
-	Macro          string `json:"macro,omitempty"`
-	NoteText       string `json:"notes,omitempty"`
-	Origin         string `json:"origin,omitempty"`
-	Rhythm         string `json:"rhythm,omitempty"`
-	Remark         string `json:"remark,omitempty"`
-	Source         string `json:"source,omitempty"`
-	UserDefined    string `json:"userDefined,omitempty"`
-	Transcription  string `json:"transcription,omitempty"`
+	Area           string       `json:"area,omitempty"`
+	Book           string       `json:"book,omitempty"`
+	Composer       string       `json:"composer,omitempty"`
+	Discography    string       `json:"discography,omitempty"`
+	FileURL        string       `json:"fileURL,omitempty"`
+	Group          string       `json:"group,omitempty"`
+	History        string       `json:"history,omitempty"`
+	UnitNoteLength Fraction     `json:"unitNoteLength"`
+	Meter          *Meter       `json:"meter,omitempty"`
+	MeterTop       uint64       `json:"meterTop,omitempty"`
+	MeterBottom    uint64       `json:"meterBottom,omitempty"`
+	Macro          []Macro      `json:"macro,omitempty"`
+	NoteText       string       `json:"notes,omitempty"`
+	Origin         string       `json:"origin,omitempty"`
+	Rhythm         string       `json:"rhythm,omitempty"`
+	Remark         string       `json:"remark,omitempty"`
+	Source         string       `json:"source,omitempty"`
+	UserDefined    []UserSymbol `json:"userDefined,omitempty"`
+	Words          string       `json:"words,omitempty"`
+	Transcription  string       `json:"transcription,omitempty"`
 
 	Tunes []Tune
+
+	//Lenient makes the decoder recover from errors instead of stopping.
+	//Malformed elements are skipped up to the next barline, malformed information fields
+	//up to the next line and malformed tunes up to the next "X:" field.
+	//Errors are still reported as diagnostics and affected tunes are marked Partial.
+	Lenient bool `json:"-"`
+
+	//Diagnostics holds the warnings and errors found while decoding.
+	//If DiagnosticHandler is set, diagnostics are passed to it instead.
+	Diagnostics       []Diagnostic     `json:"diagnostics,omitempty"`
+	DiagnosticHandler func(Diagnostic) `json:"-"`
 }
 
 //readInline starts reading from '[' and consumes all up to ']'
@@ -91,32 +116,33 @@ func (d *Decoder) readInline() (string, error) {
 	if err != nil {
 		return "", errors.Wrap(err, "reading inline field failed")
 	}
-	return string(b[0 : len(b)-1]), nil
+	return string(b[1 : len(b)-1]), nil
 
 }
 
 //readMagicNumber reads the first line and returns an error if not an ABC file.
 func (d *Decoder) readMagicNumber() error {
+	start := d.r.pos
 	line, err := d.r.ReadBytes('\n')
-	if err != nil {
-		return errors.Wrap(err, "could not read abc-file version")
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return d.fail(start, CodeNotABC, errors.Wrap(err, "could not read abc-file version"))
 	}
-	if len(line) <= 4 {
-		return errors.Wrap(errors.New("first line too short"), "no abc-file found")
+	if len(line) < 4 {
+		return d.fail(start, CodeNotABC, errors.Wrap(errors.New("first line too short"), "no abc-file found"))
 	}
 	abc := line[0:4]
 	if bytes.Compare(abc, []byte("%abc")) != 0 {
-		return errors.Wrap(errors.New("first line not starting with %abc"), "no abc-file found")
+		return d.fail(start, CodeNotABC, errors.Wrap(errors.New("first line not starting with %abc"), "no abc-file found"))
 	}
-	version := line[5 : len(line)-1] //stripping \n
+	version := strings.TrimPrefix(strings.TrimSpace(string(line[4:])), "-")
 	if len(version) != 0 {
-		bigFloat, err := strconv.ParseFloat(string(version), 32)
+		bigFloat, err := strconv.ParseFloat(version, 32)
 		if err != nil {
-			return errors.Wrap(err, "could not figure out abc-file version number")
+			return d.fail(start, CodeNotABC, errors.Wrap(err, "could not figure out abc-file version number"))
 		}
 		d.Version = float32(bigFloat)
 		if d.Version <= 2.0 {
-			fmt.Println("WARNING: abc-version is not 2.1+")
+			d.diagnose(start, SeverityWarning, CodeOldVersion, "abc-version is not 2.1+")
 		}
 	}
 
@@ -124,23 +150,18 @@ func (d *Decoder) readMagicNumber() error {
 }
 
 //readLine does not only read a line, but it also trims the comments!
+//The last line of a file does not need to end with a lineFeed.
 func (d *Decoder) readLine() (string, error) {
 	b, err := d.r.ReadBytes('\n')
-	if err != nil {
+	if err != nil && (err != io.EOF || len(b) == 0) {
 		return "", err
 	}
-	commentStart := len(b) - 1
-	for i := 0; i < len(b); i++ {
-
-		if b[i] == '%' {
-			commentStart = i
-			break
-		}
-	}
-	if commentStart != len(b)-1 {
+	b = bytes.TrimSuffix(b, []byte("\n"))
+	commentStart := bytes.IndexByte(b, '%')
+	if commentStart != -1 {
 		return strings.TrimSpace(string(b[0:commentStart])), nil
 	}
-	return strings.TrimSpace(string(b[0 : len(b)-1])), nil
+	return strings.TrimSpace(string(b)), nil
 
 }
 
@@ -165,7 +186,7 @@ func (d *Decoder) skipComments() {
 //NewDecoder returns a decoder that can be used to decode an ABC file.
 //if a filecheck needs to be omitted, set second parameter to true.
 func NewDecoder(reader bufio.Reader, disableFileCheck bool) *Decoder {
-	return &Decoder{r: &reader, fileCheck: disableFileCheck}
+	return &Decoder{r: newPositionReader(&reader), fileCheck: disableFileCheck}
 }
 
 //skips the Byte Order Mark if present
@@ -181,52 +202,38 @@ func (d *Decoder) skipBOM() error {
 }
 
 //Decode will decode the ABC file and stores everything in the Decoder struct
+//All tunes of a tunebook are decoded, each one separated by an empty line.
 func (d *Decoder) Decode() error {
-	//here, decode the thing. Return err if necessary.
-
-	//abc file structure
-	//first character: possibly Byte Order Mark (BOM) ignore this.
-	err := d.skipBOM()
-	if err != nil {
-		return err
-	}
-
-	//first line: %abc-<version number>
-	if !d.fileCheck {
-		err = d.readMagicNumber()
+	for {
+		tune, err := d.Next()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
+		d.Tunes = append(d.Tunes, *tune)
 	}
+}
 
-	d.skipComments()
-
-	//optional file header
-	err = d.readFileHeader()
-	if err != nil {
-		return err
-	}
-	//if there was a file header, the next line is just a newline character.
-	b, err := d.r.ReadBytes('\n')
-	if err != nil {
-		return err
-	}
-	if len(b) != 1 {
-		return errors.Wrap(errors.New("not abc file"), "file header was not followed by an empty newline")
+//Next decodes the next tune of the file and returns it, without storing it in Tunes.
+//The fields of the file header are already applied to the tune.
+//io.EOF is returned when there are no more tunes.
+func (d *Decoder) Next() (*Tune, error) {
+	if !d.started {
+		d.started = true
+		err := d.readStart()
+		if err != nil {
+			return nil, d.fail(d.r.pos, CodeSyntax, err)
+		}
 	}
 
-	err = d.readTuneHeader()
-	if err != nil {
-		return err
-	}
 	//abc Tunes
 	//      tune header
 	//            tune header starts with "X:"(reference number) followed by "T:" (title) and finish with "K:" (key)
 	//      tune body
 	//            music codes
 	//termintated by either EOF or newline
-
-	err = d.readTuneBody()
 	//a line starting with "%" is a comment and should be ignored.
 	//a line starting with "r:" is a remark and behaves like a comment.
 
@@ -236,41 +243,117 @@ func (d *Decoder) Decode() error {
 	//     for information fields, it's "+:" at the following line
 	//     for comments, it's just %, so nothing special
 	//     for stylesheet directives, it could be I:<directive>
+	for {
+		err := d.skipToTune()
+		if err == io.EOF {
+			return nil, err
+		}
+		if err != nil {
+			return nil, d.fail(d.r.pos, CodeRead, err)
+		}
+		err = d.readTuneHeader()
+		if err == nil {
+			err = d.readTuneBody()
+		}
+		if err == nil {
+			d.endMusic()
+			return d.tune, nil
+		}
+		err = d.fail(d.r.pos, CodeSyntax, err)
+		if !d.Lenient {
+			return nil, err
+		}
+		if d.tune != nil {
+			d.tune.Partial = true
+			return d.tune, nil
+		}
+		//nothing of this tune could be decoded, try the next one.
+	}
+}
+
+//readStart reads everything in front of the first tune: the version and the file header.
+func (d *Decoder) readStart() error {
+	//abc file structure
+	//first character: possibly Byte Order Mark (BOM) ignore this.
+	err := d.skipBOM()
+	if err != nil {
+		return err
+	}
 
-	// line, err := d.r.ReadBytes('\n')
-	// if err != nil {
-	// 	return err
-	// }
-	line, _ := d.r.ReadBytes('\n')
-	fmt.Println(string(line))
-	// fmt.Println(line)
+	//first line: %abc-<version number>
+	if !d.fileCheck {
+		err = d.readMagicNumber()
+		if err != nil {
+			return err
+		}
+	}
 
-	return nil
+	d.skipComments()
+
+	//optional file header
+	return d.readFileHeader()
+}
+
+//skipToTune skips empty lines, comments and free text up to the next "X:" field.
+//It returns io.EOF if there are no more tunes.
+func (d *Decoder) skipToTune() error {
+	for {
+		b, err := d.r.Peek(2)
+		if len(b) == 0 {
+			return err
+		}
+		if bytes.Compare(b, []byte("X:")) == 0 {
+			return nil
+		}
+		_, err = d.r.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+	}
 }
 
 func (d *Decoder) readTuneHeader() error {
-	before := len(d.Tunes)
+	d.tune = nil
+	d.voiceState = voiceState{signature: map[string]Fraction{}, barAccidentals: map[string]Fraction{}}
+	d.voice = ""
+	d.voiceStates = map[string]voiceState{}
+	d.symbols = defaultSymbols()
+	for _, symbol := range d.UserDefined {
+		d.defineSymbol(symbol)
+	}
 
 	//first line must be reference number X
-	err := d.readInformationField(false)
+	start := d.r.pos
+	err := d.recoverFrom(d.readInformationField(false))
 	if err != nil {
 		return err
 	}
-	if len(d.Tunes) == before {
-		return errors.Wrap(errors.New("not abc file"), "tune header must start with reference number field")
+	if d.tune == nil {
+		return d.fail(start, CodeSyntax, errors.Wrap(errors.New("not abc file"), "tune header must start with reference number field"))
 	}
 
 	//second line must be Title of the tune!
-	err = d.readInformationField(false)
+	start = d.r.pos
+	err = d.recoverFrom(d.readInformationField(false))
 	if err != nil {
 		return err
 	}
-	if d.Tunes[len(d.Tunes)-1].Title == "" {
-		return errors.Wrap(errors.New("not abc file"), "second line of tune header must be Title field")
+	if d.tune.Title == "" {
+		err = d.recoverFrom(d.fail(start, CodeSyntax, errors.Wrap(errors.New("not abc file"), "second line of tune header must be Title field")))
+		if err != nil {
+			return err
+		}
 	}
 
 	for !d.tuneHeaderDone {
-		err = d.readInformationField(false)
+		b, err := d.r.Peek(1)
+		if len(b) == 0 || b[0] == '\n' {
+			if err == nil || err == io.EOF {
+				err = errors.New("tune header must end with the key field")
+			}
+			return d.fail(d.r.pos, CodeSyntax, err)
+		}
+		err = d.recoverFrom(d.readInformationField(false))
 		if err != nil {
 			return err
 		}
@@ -286,60 +369,173 @@ func (d *Decoder) readTuneHeader() error {
 //abc-music ::= abc-line+
 func (d *Decoder) readTuneBody() error {
 	//initializing the first measure with one notegroup! Otherwise, it can not be appended to
-	d.Tunes[len(d.Tunes)-1].Measures = make([]Measure, 1)
-	d.Tunes[len(d.Tunes)-1].Measures[0].NoteGroups = make([]NoteGroup, 1)
+	d.tune.Measures = make([]Measure, 1)
+	d.tune.Measures[0].NoteGroups = make([]NoteGroup, 1)
 
 	d.skipComments()
-	b, err := d.r.Peek(1)
+	b, err := d.r.Peek(2)
+	if err == io.EOF && len(b) > 0 {
+		err = nil
+	}
 	if err != nil {
+		if err == io.EOF {
+			return nil
+		}
 		return errors.Wrap(err, "could not read tune body")
 	}
 
-	for bytes.Compare(b, []byte("\n")) != 0 {
+	//the tune body ends with an empty line, EOF or, if the empty line is missing, the next tune.
+	for !isEmptyLine(b) && bytes.Compare(b, []byte("X:")) != 0 {
 		err = d.readABCLine()
 		if err != nil {
 			return err
 		}
 		d.skipComments()
-		nl, err := d.r.ReadByte()
-		if err != nil {
-			return err
-		}
-		if nl != '\n' {
-			return nil
-		}
-		b, err = d.r.Peek(1)
-		if err != nil {
+		b, err = d.r.Peek(2)
+		if len(b) == 0 {
+			if err == io.EOF {
+				return nil
+			}
 			return err
 		}
-
 	}
 	return nil
 }
 
+//isEmptyLine tells whether the peeked bytes start with an empty line.
+func isEmptyLine(b []byte) bool {
+	return b[0] == '\n' || bytes.Compare(b, []byte("\r\n")) == 0
+}
+
 // musicLine ::= comment | (tuneBodyInfoField, lineFeed) | (element, {element} , lineFeed) ;
 //can not be comment as these were skipped in previous section.
+//readABCLine also consumes the lineFeed.
 func (d *Decoder) readABCLine() error {
 	b, err := peekLexToken(d.r)
 	if err != nil {
 		return err
 	}
 	if b.isTuneBodyInfoField() {
-		err = d.readInformationField(false)
+		//reading the information field also consumes the lineFeed.
+		return d.recoverFrom(d.readInformationField(false))
+	}
+	for !b.isNewline() && !b.isComment() {
+		start := d.r.pos
+		expanded := false
+		expanded, err = d.readMacro()
+		if expanded {
+			//the music of the macro is read already.
+		} else if b.isElement() || b.isSymbol(d.symbols) {
+			err = d.readElement()
+		} else {
+			err = d.fail(start, CodeSyntax, errors.Errorf("unexpected character %q", d.r.peekRune()))
+		}
 		if err != nil {
-			return err
+			err = d.recoverFrom(err)
+			if err != nil {
+				return err
+			}
+			d.skipElement(start)
 		}
+		b, err = peekLexToken(d.r)
+		if err != nil {
+			break
+		}
+	}
+
+	nl, err := d.r.ReadByte()
+	if err == io.EOF {
+		//the last line of the file does not need a lineFeed.
+		nl, err = '\n', nil
 	}
-	for b.isElement() {
-		err = d.readElement()
+	if err != nil {
+		return err
+	}
+	if nl == '\r' {
+		nl, err = d.r.ReadByte()
 		if err != nil {
 			return err
 		}
-		b, err = peekLexToken(d.r)
 	}
+	if nl == '%' {
+		//trailing comment, which runs up to and including the lineFeed.
+		d.r.UnreadByte()
+		d.skipComments()
+	}
+
+	//the end of a line also ends the beam of the current notegroup.
+	currentMeasure := d.currentMeasure()
+	currentMeasure.NoteGroups[len(currentMeasure.NoteGroups)-1].LineBreak = true
+	currentMeasure.NoteGroups = append(currentMeasure.NoteGroups, NoteGroup{})
+	return nil
+}
+
+//endMusic keeps the decorations and text at the end of the music of each voice with its last measure.
+//Anything else that is not followed by a note is reported.
+func (d *Decoder) endMusic() {
+	d.voiceStates[d.voice] = d.voiceState
+	voices := make([]string, 0, len(d.voiceStates))
+	for voice := range d.voiceStates {
+		voices = append(voices, voice)
+	}
+	sort.Strings(voices)
+	for _, voice := range voices {
+		d.voice = voice
+		state := d.voiceStates[voice]
+		d.currentMeasure().attachBarline(&state.attached)
+		if !reflect.DeepEqual(state.attached, Attached{}) {
+			d.diagnose(d.r.pos, SeverityWarning, CodeSyntax, "the symbols at the end of the tune are not followed by a note")
+		}
+	}
+}
+
+//currentMeasure returns the measure of the tune body that is being decoded.
+func (d *Decoder) currentMeasure() *Measure {
+	measures := *d.measures()
+	return &measures[len(measures)-1]
+}
+
+//addUnit adds a unit to the last notegroup of the current measure.
+//Chord symbols and other things written in front of it are attached to a note, rest or chord.
+func (d *Decoder) addUnit(unit Unit) {
+	if a, ok := unit.(attacher); ok {
+		*a.attached() = d.attached
+		d.attached = Attached{}
+	}
+	m := d.currentMeasure()
+	m.NoteGroups[len(m.NoteGroups)-1].addUnit(unit)
+}
 
+//recoverFrom returns err, unless the decoder is lenient and decoding can continue.
+//In that case, the error is only kept as a diagnostic and the tune is marked as partially decoded.
+func (d *Decoder) recoverFrom(err error) error {
+	if err == nil || !d.Lenient || errors.Cause(err) == io.EOF {
+		return err
+	}
+	d.fail(d.r.pos, CodeSyntax, err)
+	if d.tune != nil {
+		d.tune.Partial = true
+	}
 	return nil
 }
+
+//skipElement skips the rest of an element that could not be decoded,
+//up to the next barline or the end of the line.
+func (d *Decoder) skipElement(start position) {
+	b, err := d.r.Peek(1)
+	if err == nil && d.r.pos == start && b[0] != '\n' {
+		//the element was not read at all, so skip at least one byte.
+		d.r.ReadByte()
+	}
+	for {
+		b, err = d.r.Peek(1)
+		if err != nil || b[0] == '|' || b[0] == '\n' || b[0] == '\r' {
+			return
+		}
+		d.r.ReadByte()
+	}
+}
+
 func (d *Decoder) readPitch() (string, error) {
 	rePitch := regexp.MustCompile(`[a-gA-G]`)
 	reOctave := regexp.MustCompile(`[',]`)
@@ -351,10 +547,13 @@ func (d *Decoder) readPitch() (string, error) {
 	if rePitch.Match([]byte(string(b))) {
 		retString += string(b)
 	} else {
-		return "", errors.Wrap(errors.New("reading note failed"), "still need to implement accidentals in notes.")
+		return "", errors.Wrap(errors.New("reading note failed"), "expected a note letter")
 	}
 	for {
 		b, err = d.r.ReadByte()
+		if err != nil {
+			return retString, nil //end of file ends the pitch
+		}
 		if rePitch.Match([]byte(string(b))) {
 
 			d.r.UnreadByte()
@@ -369,223 +568,496 @@ func (d *Decoder) readPitch() (string, error) {
 
 }
 
-//element ::= note | annotation | barline | space | inLine | repeat | chord | brokenRhythm;
+//readNote reads a note with its accidental, pitch and duration.
+//The alteration of the note follows from its accidental, the accidentals
+//earlier in the bar and the key signature.
+func (d *Decoder) readNote() (*Note, error) {
+	accidental, err := d.readAccidental()
+	if err != nil {
+		return nil, err
+	}
+	pitch, err := d.readPitch()
+	if err != nil {
+		return nil, err
+	}
+	duration, err := d.readDuration()
+	if err != nil {
+		return nil, err
+	}
+	note := &Note{Value: pitch, Accidental: accidental, Duration: duration, UnitNoteLength: d.unitNoteLength}
+	note.Step, note.Octave = parsePitch(pitch)
+	note.Alteration = d.alteration(note)
+	note.Transpose = d.transpose
+	if voice := d.tune.Voice(d.voice); voice != nil {
+		note.Transpose += voice.semitones()
+	}
+	for _, tied := range d.ties {
+		if tied.Step == note.Step && tied.Octave == note.Octave {
+			//the accidental of a tied note also holds across the barline.
+			note.TieEnd = true
+			if note.Accidental == nil {
+				note.Alteration = tied.Alteration
+			}
+		}
+	}
+	return note, nil
+}
+
+//readRest reads a rest, an invisible rest or a multi-measure rest with its duration.
+//rest ::= ('z' | 'x'), duration | ('Z' | 'X'), {DIGIT};
+func (d *Decoder) readRest() (*Rest, error) {
+	start := d.r.pos
+	symbol, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	rest := &Rest{Invisible: symbol == 'x' || symbol == 'X', UnitNoteLength: d.unitNoteLength}
+	if symbol == 'z' || symbol == 'x' {
+		rest.Duration, err = d.readDuration()
+		return rest, err
+	}
+
+	rest.Measures = 1
+	if digits := d.readDigits(); len(digits) > 0 {
+		rest.Measures, err = strconv.Atoi(string(digits))
+		if err != nil || rest.Measures == 0 {
+			return nil, errors.New("number of measures of the rest not properly formatted")
+		}
+	}
+	//the rest takes the full length of its measures.
+	measureLength := NewFraction(0, 1)
+	if d.meter != nil {
+		measureLength = d.meter.Length()
+	}
+	if measureLength.Numerator == 0 {
+		d.diagnose(start, SeverityWarning, CodeSyntax, "rest of whole measures takes no time, as there is no meter")
+	}
+	rest.Duration = NewFraction(int64(rest.Measures), 1).Mul(measureLength).Div(d.unitNoteLength)
+	return rest, nil
+}
+
+//readQuoted reads the text between double quotes, which must be on a single line.
+func (d *Decoder) readQuoted() (string, error) {
+	d.r.ReadByte() //skipping '"'
+	var text []byte
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil || b[0] == '\n' {
+			return "", errors.New("text is not closed by '\"'")
+		}
+		d.r.ReadByte()
+		if b[0] == '"' {
+			return string(text), nil
+		}
+		text = append(text, b[0])
+	}
+}
+
+//tie ties a note, or all notes of a chord, to the next note of the same pitch.
+func (d *Decoder) tie(previous Unit, dotted bool) error {
+	switch unit := previous.(type) {
+	case *Note:
+		unit.TieStart, unit.TieDotted = true, dotted
+		d.ties = []*Note{unit}
+	case *Chord:
+		d.ties = nil
+		for i := range unit.notes {
+			unit.notes[i].TieStart, unit.notes[i].TieDotted = true, dotted
+			d.ties = append(d.ties, &unit.notes[i])
+		}
+	default:
+		return errors.New("tie must follow a note")
+	}
+	return nil
+}
+
+//readChord reads the notes of a chord and the duration after it.
+//The notes may have a length of their own, the chord lasts as long as its first note.
+//The duration after the chord applies to all of its notes.
+//chord ::= '[', note, {note}, ']', [duration];
+func (d *Decoder) readChord() (*Chord, error) {
+	d.r.ReadByte() //skipping '['
+	chord := &Chord{UnitNoteLength: d.unitNoteLength}
+	for {
+		b, err := peekLexToken(d.r)
+		if err != nil {
+			return nil, errors.Wrap(err, "chord is not closed by ']'")
+		}
+		if b.token[0] == ']' {
+			d.r.ReadByte()
+			break
+		}
+		if !b.isPitch() {
+			return nil, errors.Errorf("unexpected character %q in chord", d.r.peekRune())
+		}
+		note, err := d.readNote()
+		if err != nil {
+			return nil, err
+		}
+		b, _ = peekLexToken(d.r)
+		if b.isTie() {
+			//a single note of the chord is tied, like the C in "[C-E]".
+			note.TieStart, note.TieDotted = true, b.token[0] == '.'
+			d.r.ReadByte()
+			if note.TieDotted {
+				d.r.ReadByte()
+			}
+		}
+		chord.notes = append(chord.notes, *note)
+		chord.Value += note.Value
+	}
+	if len(chord.notes) == 0 {
+		return nil, errors.New("chord has no notes")
+	}
+
+	duration, err := d.readDuration()
+	if err != nil {
+		return nil, err
+	}
+	for i := range chord.notes {
+		chord.notes[i].Duration = chord.notes[i].Duration.Mul(duration)
+	}
+	chord.Duration = chord.notes[0].Duration
+	return chord, nil
+}
+
+//element ::= note | annotation | barline | space | inLine | ending | chord | brokenRhythm;
 func (d *Decoder) readElement() error {
-	tuneMeasures := &d.Tunes[len(d.Tunes)-1].Measures
+	tuneMeasures := d.measures()
 	currentMeasure := &(*tuneMeasures)[len((*tuneMeasures))-1]
-	// fmt.Println("length of measures:", len((*tuneMeasures)))
+	start := d.r.pos
 
 	b, err := peekLexToken(d.r)
 
 	if err != nil {
-		return err
+		return d.fail(start, CodeSyntax, err)
 	}
 
 	if b.isNote() {
+		var unit Unit
 		if b.isPitch() {
-			pitch, err := d.readPitch() //TODO: this must be done properly.
-			if err != nil {
-				return err
-			}
-			duration, err := d.readDuration()
-			if err != nil {
-				return err
-			}
-			if d.halveDuration {
-				duration /= 2.0
-				d.halveDuration = false
-			} else if d.doubleDuration {
-				duration *= 2.0
-				d.doubleDuration = false
-			}
-			currentMeasure.NoteGroups[len(currentMeasure.NoteGroups)-1].addUnit(&Note{Value: pitch, Duration: duration})
-		} else if b.isRest() {
-
+			unit, err = d.readNote()
+		} else {
+			unit, err = d.readRest()
+		}
+		if err != nil {
+			return d.fail(start, CodeSyntax, err)
 		}
+		d.scaleTuplet(unit)
+		if d.brokenRhythm != nil {
+			unit.SetDuration(unit.GetDuration().Mul(*d.brokenRhythm))
+			d.brokenRhythm = nil
+		}
+		d.addUnit(unit)
+		d.ties = nil
 	} else if b.isAnnotation() {
-		_, err = d.r.ReadByte() //Can't be anything other than '"'
+		//a chord symbol or annotation belongs to the note after it.
+		text, err := d.readQuoted()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
 		}
-		fullAnnotation, err := d.r.ReadBytes('"') //reads the full annotation, including the last '"'
+		d.attached.parseQuoted(text)
+
+	} else if b.isGraceNotes() {
+		//grace notes belong to the note after them.
+		grace, err := d.readGraceNotes()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
+		}
+		d.attached.GraceNotes = grace
+
+	} else if b.isDecoration() {
+		//a decoration belongs to the note or barline after it.
+		decoration, err := d.readDecoration()
+		if err != nil {
+			return d.fail(start, CodeSyntax, err)
 		}
-		annotation := fullAnnotation[0 : len(fullAnnotation)-2] //stripping the '"'
-		fmt.Println("annotation:", annotation)
+		d.attached.Decorations = append(d.attached.Decorations, decoration)
 
 	} else if b.isSpace() {
 		//start a new notegroup, skip space
 		currentMeasure.NoteGroups = append(currentMeasure.NoteGroups, NoteGroup{})
 		_, err := d.r.ReadByte()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
 		}
 	} else if b.isBarline() {
-		//start a new measure, skip barline (could potentially be start/end of repeat)
-		barline, err := d.r.ReadByte()
+		//start a new measure, the barline tells where repeats start and end
+		barline, err := d.readBarline()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
 		}
 
 		(*tuneMeasures) = append((*tuneMeasures), Measure{NoteGroups: make([]NoteGroup, 1)})
 
 		currentMeasure := &(*tuneMeasures)[len((*tuneMeasures))-2]
 		newMeasure := &(*tuneMeasures)[len((*tuneMeasures))-1]
-		switch barline {
-		case '[':
-			currentMeasure.ThickEnd = true
-		case ':':
-			currentMeasure.RepeatEnd = true
-		}
-		newBarline, err := d.r.Peek(1)
-		if err != nil {
-			return err
+		d.barAccidentals = map[string]Fraction{}
+		//decorations and text in front of the barline belong to it.
+		currentMeasure.attachBarline(&d.attached)
+		setBarline(currentMeasure, newMeasure, barline)
+
+		//an ending may follow the barline without '[', like "|1" or ":|2".
+		if b, err := d.r.Peek(1); err == nil && b[0] >= '0' && b[0] <= '9' {
+			newMeasure.Ending, newMeasure.EndingNotation, err = d.readEnding()
+			if err != nil {
+				return d.fail(start, CodeSyntax, err)
+			}
 		}
-		switch newBarline[0] {
-		case '|':
-			newMeasure.BarlineStart = true
-			_, err = d.r.ReadByte()
-
-		case '[':
-			newMeasure.ThickStart = true
-			_, err = d.r.ReadByte()
-
-		case ':':
-			newMeasure.RepeatStart = true
-			_, err = d.r.ReadByte()
 
+	} else if b.isInline() {
+		err = d.readInformationField(true)
+		if err != nil {
+			return d.fail(start, CodeSyntax, err)
 		}
+	} else if b.isEnding() {
+		//the ending starts with the measure it is in.
+		currentMeasure.Ending, currentMeasure.EndingNotation, err = d.readEnding()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
 		}
 
-	} else if b.isInline() {
-		err = d.readInformationField(true)
+	} else if b.isChord() {
+		chord, err := d.readChord()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
+		}
+		d.scaleTuplet(chord)
+		if d.brokenRhythm != nil {
+			chord.SetDuration(chord.GetDuration().Mul(*d.brokenRhythm))
+			d.brokenRhythm = nil
+		}
+		d.addUnit(chord)
+		d.ties = nil
+		for i := range chord.notes {
+			if chord.notes[i].TieStart {
+				d.ties = append(d.ties, &chord.notes[i])
+			}
 		}
-	} else if b.isRepeat() {
 
-	} else if b.isChord() {
-		_, err = d.r.ReadByte()
+	} else if b.isTie() {
+		tie, _ := d.r.ReadByte()
+		if tie == '.' {
+			d.r.ReadByte() //skipping '-'
+		}
+		err = d.tie(currentMeasure.lastUnit(), tie == '.')
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
 		}
-		fullChord, err := d.r.ReadBytes(']')
+
+	} else if b.isTuplet() {
+		tuplet, err := d.readTuplet()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
+		}
+		group := &currentMeasure.NoteGroups[len(currentMeasure.NoteGroups)-1]
+		tuplet.Start = len(group.Units)
+		group.Tuplets = append(group.Tuplets, tuplet)
+		d.tuplets = append(d.tuplets, tuplet.state())
+
+	} else if b.isSlurStart() {
+		slur, _ := d.r.ReadByte()
+		if slur == '.' {
+			d.r.ReadByte() //skipping '('
+			d.attached.SlurStarts = append(d.attached.SlurStarts, ".(")
+		} else {
+			d.attached.SlurStarts = append(d.attached.SlurStarts, "(")
 		}
-		chord := fullChord[0 : len(fullChord)-2] //stripping the ending ']'
-		fmt.Println("chord:", chord)
+
+	} else if b.isSlurEnd() {
+		d.r.ReadByte()
+		previous, ok := currentMeasure.lastUnit().(attacher)
+		if !ok {
+			return d.fail(start, CodeSyntax, errors.New("slur must end on a note"))
+		}
+		previous.attached().SlurEnd++
+
+	} else if b.isSymbol(d.symbols) {
+		d.readSymbol()
 
 	} else if b.isBrokenRhythm() {
+		//'>' dots the previous note and halves the next one, '>>' double dots and quarters etc.
 		brokenRhythm, err := d.r.ReadByte()
 		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, err)
+		}
+		count := int64(1)
+		for {
+			b, err := d.r.Peek(1)
+			if err != nil || b[0] != brokenRhythm {
+				break
+			}
+			d.r.ReadByte()
+			count++
+		}
+		if count > 3 {
+			return d.fail(start, CodeSyntax, errors.Errorf("broken rhythm is longer than \"%c%c%c\"", brokenRhythm, brokenRhythm, brokenRhythm))
+		}
+		previous := currentMeasure.lastUnit()
+		if previous == nil {
+			return d.fail(start, CodeSyntax, errors.New("broken rhythm must follow a note"))
 		}
-		switch brokenRhythm {
-		case '>':
-			currNoteGroup := &currentMeasure.NoteGroups[len(currentMeasure.NoteGroups)-1]
-			currNoteGroup.Units[len(currNoteGroup.Units)-1].SetDuration(currNoteGroup.Units[len(currNoteGroup.Units)-1].GetDuration() * 2.0)
-			d.halveDuration = true
-		case '<':
-			currNoteGroup := &currentMeasure.NoteGroups[len(currentMeasure.NoteGroups)-1]
-			currNoteGroup.Units[len(currNoteGroup.Units)-1].SetDuration(currNoteGroup.Units[len(currNoteGroup.Units)-1].GetDuration() / 2.0)
-			d.doubleDuration = true
+		short := NewFraction(1, 1<<uint(count))
+		long := NewFraction(2, 1).Sub(short)
+		if brokenRhythm == '<' {
+			short, long = long, short
 		}
+		previous.SetDuration(previous.GetDuration().Mul(long))
+		d.brokenRhythm = &short
 	}
 
 	return nil
 }
 
-//readDuration returns a float with value '1.0' if no duration was found!
-func (d *Decoder) readDuration() (float64, error) {
-	var nominatorString []byte
-	var denominatorString []byte
-
-	var isFraction bool = false
-	re := regexp.MustCompile(`[0-9]`)
-
+//readBarline reads a full barline, like '|', '||', '[|', '|]', ':|', '|:', '::', '.|' or '[|]'.
+//A '[' is only part of the barline if it is followed by '|', otherwise it starts
+//an ending, chord or inline field.
+func (d *Decoder) readBarline() (string, error) {
+	var barline []byte
 	for {
-		b, err := d.r.ReadByte()
-		if err != nil {
-			return 0, err
+		b, err := d.r.Peek(2)
+		if len(b) == 0 {
+			if len(barline) > 0 {
+				return string(barline), nil
+			}
+			return "", err
 		}
-		if re.Match([]byte(string(b))) {
-			nominatorString = append(nominatorString, b)
-		} else {
-			isFraction = (b == '/')
-			break
+		switch {
+		case b[0] == '|' || b[0] == ':':
+		case b[0] == '.' && len(barline) == 0 && len(b) > 1 && b[1] == '|':
+		case b[0] == ']' && len(barline) > 0 && barline[len(barline)-1] == '|':
+		case b[0] == '[' && len(b) > 1 && b[1] == '|':
+		default:
+			return string(barline), nil
+		}
+		barline = append(barline, b[0])
+		_, err = d.r.ReadByte()
+		if err != nil {
+			return "", err
 		}
 	}
+}
+
+//maxDenominator is the shortest duration that can be written with '/' only, 1/1024 of the unit note length.
+const maxDenominator = 1024
+
+//readDuration returns the duration written after a note, which is 1 if no duration was found!
+//duration ::= DIGIT {DIGIT} | {DIGIT} '/' {DIGIT} | {DIGIT} '/' {'/'};
+//a '/' without denominator halves, so 'a/' is 'a/2' and 'a//' is 'a/4'.
+func (d *Decoder) readDuration() (Fraction, error) {
+	nominatorString := d.readDigits()
+	b, _ := d.r.Peek(1)
+	isFraction := len(b) > 0 && b[0] == '/'
 
 	if len(nominatorString) == 0 && !isFraction {
-		d.r.UnreadByte()
-		return 1, nil //no duration given.
+		return NewFraction(1, 1), nil //no duration given.
 	}
-	var nominator float64 = 0
+	var nominator int64 = 1
 	var err error
 	if len(nominatorString) > 0 {
-		nominator, err = strconv.ParseFloat(string(nominatorString), 64)
+		nominator, err = strconv.ParseInt(string(nominatorString), 10, 64)
 		if err != nil {
-			return 0, err
+			return Fraction{}, err
+		}
+		if nominator == 0 {
+			return Fraction{}, errors.New("duration can not be zero")
 		}
 	}
 
 	if !isFraction {
-		d.r.UnreadByte()
-		return nominator, nil
+		return NewFraction(nominator, 1), nil
 	}
-	//fraction sign '/' has been read.
-	for {
-		b, err := d.r.ReadByte()
-		if err != nil {
-			return 0, err
-		}
-		if re.Match([]byte(string(b))) {
-			denominatorString = append(denominatorString, b)
-		} else {
-			d.r.UnreadByte()
-			break
-		}
+	_, err = d.r.ReadByte() //fraction sign '/'
+	if err != nil {
+		return Fraction{}, err
 	}
+	denominatorString := d.readDigits()
 	if len(denominatorString) == 0 {
-		return 0, errors.New("no denominator found in duration")
+		//each '/' halves the duration.
+		denominator := int64(2)
+		for {
+			b, _ = d.r.Peek(1)
+			if len(b) == 0 || b[0] != '/' {
+				break
+			}
+			d.r.ReadByte()
+			denominator *= 2
+			if denominator > maxDenominator {
+				return Fraction{}, errors.New("duration has too many '/'")
+			}
+		}
+		return NewFraction(nominator, denominator), nil
 	}
-	denominator, err := strconv.ParseFloat(string(denominatorString), 64)
+	denominator, err := strconv.ParseInt(string(denominatorString), 10, 64)
 	if err != nil {
-		return 0, err
+		return Fraction{}, err
 	}
-	if nominator == 0 {
-		nominator++
+	if denominator == 0 {
+		return Fraction{}, errors.New("duration can not have a zero denominator")
+	}
+	return NewFraction(nominator, denominator), nil
+}
+
+//readDigits reads all digits up to the first non-digit, which may be none at all.
+func (d *Decoder) readDigits() []byte {
+	var digits []byte
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil || b[0] < '0' || b[0] > '9' {
+			return digits
+		}
+		digits = append(digits, b[0])
+		d.r.ReadByte()
 	}
-	return nominator / denominator, nil
 }
 
 //readfileHeader reads the file header if there is any.
 func (d *Decoder) readFileHeader() error {
 	b, err := d.r.Peek(1)
+	if err == io.EOF {
+		return nil //no tunes at all
+	}
 	if err != nil {
 		return errors.Wrap(err, "read operation failed")
 	}
-	if string(b) == "X" { //No file header present
+	if string(b) == "X" || string(b) == "\n" { //No file header present
 		return nil
 	}
 	d.inFileHeader = true
-	var done bool = false
-	for !done {
+	for {
 		//forloop read informationFields
-		err = d.readInformationField(false)
-		b, err = d.r.Peek(1)
+		err = d.recoverFrom(d.readInformationField(false))
+		if errors.Cause(err) == io.EOF {
+			//the file only has a file header.
+			break
+		}
 		if err != nil {
+			d.inFileHeader = false
 			return err
 		}
-		if bytes.Compare(b, []byte("\n")) == 0 {
+		b, _ = d.r.Peek(2)
+		if len(b) == 0 || b[0] == '\n' {
 			//fileHeader is done.
-			done = true
+			break
+		}
+		if bytes.Compare(b, []byte("X:")) == 0 {
+			//the first tune starts right after the file header.
+			d.inFileHeader = false
+			d.diagnose(d.r.pos, SeverityWarning, CodeSyntax, "file header was not followed by an empty line")
+			return nil
 		}
 	}
 	d.inFileHeader = false
+	//the file header is followed by an empty line.
+	b, err = d.r.ReadBytes('\n')
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(b) != 1 {
+		return errors.Wrap(errors.New("not abc file"), "file header was not followed by an empty newline")
+	}
 	return nil
 }
@@ -0,0 +1,315 @@
+package abc
+
+import (
+	"bufio"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//decodeTune decodes the first tune of an abc file that does not have to start with "%abc".
+func decodeTune(t *testing.T, in string, lenient bool) (*Tune, *Decoder) {
+	t.Helper()
+	d := NewDecoder(*bufio.NewReader(strings.NewReader(in)), true)
+	d.Lenient = lenient
+	tune, err := d.Next()
+	if err != nil {
+		t.Fatalf("decoding %q: %v", in, err)
+	}
+	return tune, d
+}
+
+//notes returns the notes of measures as their pitch name and duration in unit note lengths, like "F#4:1/2".
+func notesOf(measures []Measure) []string {
+	var names []string
+	for _, m := range measures {
+		for _, ng := range m.NoteGroups {
+			for _, u := range ng.Units {
+				if n, ok := u.(*Note); ok {
+					names = append(names, n.PitchName()+":"+n.Duration.String())
+				}
+			}
+		}
+	}
+	return names
+}
+
+func TestVoiceState(t *testing.T) {
+	in := "X:1\nT:duet\nM:4/4\nL:1/4\nK:C\nV:1\n[K:D]F F|[L:1/8]FF c4-\nV:2\nF F|\nV:1\nc4|\n"
+	tune, _ := decodeTune(t, in, false)
+	want := map[string]string{
+		"1": "F#4:1 F#4:1 F#4:1 F#4:1 C#5:4 C#5:4",
+		"2": "F4:1 F4:1",
+	}
+	for id, notes := range want {
+		if got := strings.Join(notesOf(tune.Voice(id).Measures), " "); got != notes {
+			t.Errorf("voice %s: got %s, want %s", id, got, notes)
+		}
+	}
+	if tied := tune.Voice("1").Measures[1].lastUnit().(*Note); !tied.TieEnd {
+		t.Errorf("tie across the other voice is lost")
+	}
+	if length := tune.Voice("2").Measures[0].NoteGroups[0].Units[0].GetAbsoluteDuration(); length != NewFraction(1, 4) {
+		t.Errorf("voice 2 has unit note length of voice 1: note lasts %v", length)
+	}
+}
+
+func TestFileHeaderFields(t *testing.T) {
+	for _, in := range []string{
+		"%abc-2.1\nW:x\n\nX:1\nT:t\nK:C\nabc|\n",
+		"%abc-2.1\nW:x\n+:y\n\nX:1\nT:t\nK:C\nabc|\n",
+		"%abc-2.1\nT:collection\n\nX:1\nT:t\nK:C\nabc|\n",
+	} {
+		for _, lenient := range []bool{false, true} {
+			d := NewDecoder(*bufio.NewReader(strings.NewReader(in)), false)
+			d.Lenient = lenient
+			if err := d.Decode(); err != nil {
+				t.Errorf("decoding %q: %v", in, err)
+			} else if len(d.Tunes) != 1 || d.Tunes[0].Title != "t" {
+				t.Errorf("decoding %q: got tunes %v", in, d.Tunes)
+			}
+		}
+	}
+}
+
+func TestLenient(t *testing.T) {
+	for _, c := range []struct {
+		in    string
+		notes string
+	}{
+		{"X:1\nT:t\nK:C\nab[X:2]c|d|\n", "A5:1 B5:1 D5:1"},
+		{"X:1\nT:t\nK:C\nab[X:x]c|d|\n", "A5:1 B5:1 D5:1"},
+		{"X:1\nT:t\nK:C\na#b|c|\n", "A5:1 C5:1"},
+		{"X:1\nT:t\nK:C\na{b|c|\n", "A5:1 C5:1"},
+		{"X:1\nT:t\nK:C\na!trill b|c|\nd|\n", "A5:1 D5:1"},
+		{"X:1\nT:t\nK:C\na[1-0 b|c|\n", "A5:1 C5:1"},
+		{"X:1\nT:t\nK:C\na>>>>b|c|\n", "A5:1 C5:1"},
+		{"X:1\nT:t\nK:C\na" + strings.Repeat("<", 64) + "b|c|\n", "A5:1 C5:1"},
+	} {
+		tune, d := decodeTune(t, c.in, true)
+		if !tune.Partial || len(d.Diagnostics) == 0 {
+			t.Errorf("%q: not reported as partially decoded", c.in)
+		}
+		if got := strings.Join(notesOf(tune.Measures), " "); got != c.notes {
+			t.Errorf("%q: got %s, want %s", c.in, got, c.notes)
+		}
+	}
+}
+
+func TestMacroFieldInBody(t *testing.T) {
+	tune, d := decodeTune(t, "X:1\nT:t\nK:C\nab|\nm:~n=nn\ncd|\n", true)
+	if tune.Partial || len(d.Diagnostics) != 1 || !strings.Contains(d.Diagnostics[0].Message, "macro field") {
+		t.Errorf("got diagnostics %v", d.Diagnostics)
+	}
+	if got := strings.Join(notesOf(tune.Measures), " "); got != "A5:1 B5:1 C5:1 D5:1" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestUnknownKeyModifier(t *testing.T) {
+	tune, d := decodeTune(t, "X:1\nT:t\nK:Dlyd stafflines=4\ng|\n[K:Hx]b|\n", false)
+	if len(d.Diagnostics) != 2 || d.Diagnostics[0].Severity != SeverityWarning {
+		t.Errorf("got diagnostics %v", d.Diagnostics)
+	}
+	if got := strings.Join(notesOf(tune.Measures), " "); got != "G#5:1 B5:1" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestFileHeader(t *testing.T) {
+	for _, c := range []struct {
+		in          string
+		lenient     bool
+		titles      string
+		err         bool
+		diagnostics int
+	}{
+		{"%abc-2.1\nC:me\n", false, "", false, 0},
+		{"%abc-2.1\nC:me\n\n", false, "", false, 0},
+		{"%abc-2.1\nM:xx\n\nX:1\nT:a\nK:C\nabc|\n", false, "", true, 1},
+		{"%abc-2.1\nM:xx\n\nX:1\nT:a\nK:C\nabc|\n", true, "a", false, 1},
+		{"%abc-2.1\nC:me\nX:1\nT:a\nK:C\nabc|\n\nX:2\nT:b\nK:C\ndef|\n", false, "a b", false, 1},
+		{"%abc-2.1\nC:me\nX:1\nT:a\nK:C\nabc|\n\nX:2\nT:b\nK:C\ndef|\n", true, "a b", false, 1},
+	} {
+		d := NewDecoder(*bufio.NewReader(strings.NewReader(c.in)), false)
+		d.Lenient = c.lenient
+		err := d.Decode()
+		if (err != nil) != c.err {
+			t.Errorf("%q: got error %v", c.in, err)
+			continue
+		}
+		var titles []string
+		for _, tune := range d.Tunes {
+			titles = append(titles, tune.Title)
+			if tune.Partial || tune.Composer != "me" && strings.Contains(c.in, "C:me") {
+				t.Errorf("%q: tune %q is not decoded with the file header", c.in, tune.Title)
+			}
+		}
+		if !c.err && strings.Join(titles, " ") != c.titles {
+			t.Errorf("%q: got tunes %v, want %s", c.in, titles, c.titles)
+		}
+		if len(d.Diagnostics) != c.diagnostics {
+			t.Errorf("%q: got diagnostics %v", c.in, d.Diagnostics)
+		}
+	}
+}
+
+func TestKeyTransposition(t *testing.T) {
+	for _, c := range []struct {
+		in    string
+		notes string
+	}{
+		{"K:C transpose=-2\nc [K:clef=bass] c|\n", "A#4:1 A#4:1"},
+		{"K:C transpose=-2\nc [K:D] c|\n", "A#4:1 B4:1"},
+		{"K:C transpose=-2\nc [K:transpose=0] c|\n", "A#4:1 C5:1"},
+		{"K:C octave=1\nc [K:bass] c [K:t=1] c|\n", "C6:1 C6:1 C#5:1"},
+	} {
+		tune, _ := decodeTune(t, "X:1\nT:t\n"+c.in, false)
+		if got := strings.Join(notesOf(tune.Measures), " "); got != c.notes {
+			t.Errorf("%q: got %s, want %s", c.in, got, c.notes)
+		}
+	}
+}
+
+func TestRest(t *testing.T) {
+	for _, c := range []struct {
+		header    string
+		body      string
+		durations string
+		invisible string
+		warnings  int
+	}{
+		{"M:4/4\nL:1/8\n", "z z2 z/ x3/2|", "1 2 1/2 3/2", "false false false true", 0},
+		{"M:4/4\nL:1/8\n", "Z|Z4|X|", "8 32 8", "false false true", 0},
+		{"M:3/4\nL:1/4\n", "Z2|", "6", "false", 0},
+		{"L:1/8\n", "Z4|", "0", "false", 1},
+		{"M:none\nL:1/8\n", "X|z|", "0 1", "true false", 1},
+	} {
+		tune, d := decodeTune(t, "X:1\nT:t\n"+c.header+"K:C\n"+c.body+"\n", false)
+		var durations, invisible []string
+		for _, m := range tune.Measures {
+			for _, ng := range m.NoteGroups {
+				for _, u := range ng.Units {
+					if rest, ok := u.(*Rest); ok {
+						durations = append(durations, rest.Duration.String())
+						invisible = append(invisible, strconv.FormatBool(rest.Invisible))
+					}
+				}
+			}
+		}
+		if got := strings.Join(durations, " "); got != c.durations {
+			t.Errorf("%q: got durations %s, want %s", c.body, got, c.durations)
+		}
+		if got := strings.Join(invisible, " "); got != c.invisible {
+			t.Errorf("%q: got invisible %s, want %s", c.body, got, c.invisible)
+		}
+		if len(d.Diagnostics) != c.warnings {
+			t.Errorf("%q: got diagnostics %v", c.body, d.Diagnostics)
+		}
+	}
+}
+
+func TestDecodeTunes(t *testing.T) {
+	for _, c := range []struct {
+		in     string
+		titles string
+		notes  string
+	}{
+		{"X:1\nT:a\nK:C\nabc|\n\nX:2\nT:b\nK:C\ndef|\n\n\nX:3\nT:c\nK:C\ng|\n", "a b c", "abc def g"},
+		{"X:1\nT:a\nK:C\nabc|\n\nX:2\nT:b\nK:C\ndef|", "a b", "abc def"},
+		{"X:1\nT:a\nK:C\nabc|\nX:2\nT:b\nK:C\ndef|\n", "a b", "abc def"},
+		{"X:1\nT:a\nK:C\nabc|\n\n% comment\nfree text\n\nX:2\nT:b\nK:C\ndef|\n", "a b", "abc def"},
+		{"X:1\nT:a\nK:C\nabc|\r\n\r\nX:2\r\nT:b\r\nK:C\r\ndef|\r\n", "a b", "abc def"},
+	} {
+		for _, lenient := range []bool{false, true} {
+			d := NewDecoder(*bufio.NewReader(strings.NewReader(c.in)), true)
+			d.Lenient = lenient
+			if err := d.Decode(); err != nil {
+				t.Errorf("%q: %v", c.in, err)
+				continue
+			}
+			var titles, notes []string
+			for _, tune := range d.Tunes {
+				titles = append(titles, tune.Title)
+				var values []string
+				for _, m := range tune.Measures {
+					for _, ng := range m.NoteGroups {
+						for _, u := range ng.Units {
+							values = append(values, u.GetValue())
+						}
+					}
+				}
+				notes = append(notes, strings.Join(values, ""))
+			}
+			if got := strings.Join(titles, " "); got != c.titles {
+				t.Errorf("%q: got tunes %s, want %s", c.in, got, c.titles)
+			}
+			if got := strings.Join(notes, " "); got != c.notes {
+				t.Errorf("%q: got notes %s, want %s", c.in, got, c.notes)
+			}
+		}
+	}
+}
+
+func TestDiagnosticPosition(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		line    int
+		column  int
+		offset  int64
+		message string
+	}{
+		{"X:1\nT:t\nK:C\nabc #|\n", 4, 5, 16, `unexpected character '#'`},
+		{"X:1\nT:Café\nK:C\n\"é\"ab é|\n", 4, 7, 23, `unexpected character 'é'`},
+		{"X:1\nT:t\nK:C\nab|\nc d>>>>e|\n", 5, 4, 19, `broken rhythm is longer than ">>>"`},
+	} {
+		d := NewDecoder(*bufio.NewReader(strings.NewReader(c.in)), true)
+		_, err := d.Next()
+		diagnostic, ok := err.(Diagnostic)
+		if !ok {
+			t.Errorf("%q: got error %v", c.in, err)
+			continue
+		}
+		if diagnostic.Line != c.line || diagnostic.Column != c.column || diagnostic.Offset != c.offset || diagnostic.Message != c.message {
+			t.Errorf("%q: got %d:%d (%d) %s, want %d:%d (%d) %s", c.in, diagnostic.Line, diagnostic.Column, diagnostic.Offset,
+				diagnostic.Message, c.line, c.column, c.offset, c.message)
+		}
+	}
+}
+
+func TestDuration(t *testing.T) {
+	for _, c := range []struct {
+		body      string
+		durations string
+	}{
+		{"a a2 a/2 a3/2 a/ a// a/// a3/", "1 2 1/2 3/2 1/2 1/4 1/8 3/2"},
+		{"z/ [ce]/4 a16", "1/2 1/4 16"},
+		{"a0", ""},
+		{"z0", ""},
+		{"[ce]0", ""},
+		{"a/0", ""},
+		{"a" + strings.Repeat("/", 64), ""},
+	} {
+		d := NewDecoder(*bufio.NewReader(strings.NewReader("X:1\nT:t\nK:C\n" + c.body + "|\n")), true)
+		tune, err := d.Next()
+		if c.durations == "" {
+			if err == nil {
+				t.Errorf("%q: no error", c.body)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", c.body, err)
+			continue
+		}
+		var durations []string
+		for _, ng := range tune.Measures[0].NoteGroups {
+			for _, u := range ng.Units {
+				durations = append(durations, u.GetDuration().String())
+			}
+		}
+		if got := strings.Join(durations, " "); got != c.durations {
+			t.Errorf("%q: got %s, want %s", c.body, got, c.durations)
+		}
+	}
+}
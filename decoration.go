@@ -0,0 +1,146 @@
+package abc
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//DecorationType tells what kind of symbol a Decoration is.
+type DecorationType string
+
+//The types of decorations.
+const (
+	DecorationOrnament     DecorationType = "ornament"
+	DecorationArticulation DecorationType = "articulation"
+	DecorationDynamic      DecorationType = "dynamic"
+	DecorationFingering    DecorationType = "fingering"
+	DecorationNavigation   DecorationType = "navigation"
+	DecorationPhrase       DecorationType = "phrase"
+	//DecorationUnknown is a decoration that is not in the abc standard, it is kept as written.
+	DecorationUnknown DecorationType = "unknown"
+)
+
+//Decoration is a symbol on a note or barline, written like "!trill!" or with a single character like "T".
+type Decoration struct {
+	//Name is the name of the decoration as written between the '!', like "trill" or "D.C.".
+	Name string         `json:"name"`
+	Type DecorationType `json:"type"`
+	//Symbol is the single character the decoration is written with, like "T" for a trill.
+	//It is empty for a decoration written like "!trill!".
+	Symbol string `json:"symbol,omitempty"`
+}
+
+//decorationTypes holds the type of each decoration of the abc standard.
+var decorationTypes = map[string]DecorationType{
+	"trill": DecorationOrnament, "trill(": DecorationOrnament, "trill)": DecorationOrnament,
+	"lowermordent": DecorationOrnament, "uppermordent": DecorationOrnament, "mordent": DecorationOrnament,
+	"pralltriller": DecorationOrnament, "roll": DecorationOrnament, "turn": DecorationOrnament,
+	"turnx": DecorationOrnament, "invertedturn": DecorationOrnament, "invertedturnx": DecorationOrnament,
+	"arpeggio": DecorationOrnament, "slide": DecorationOrnament,
+
+	"staccato": DecorationArticulation, ">": DecorationArticulation, "accent": DecorationArticulation,
+	"emphasis": DecorationArticulation, "fermata": DecorationArticulation, "invertedfermata": DecorationArticulation,
+	"tenuto": DecorationArticulation, "wedge": DecorationArticulation, "snap": DecorationArticulation,
+	"upbow": DecorationArticulation, "downbow": DecorationArticulation, "breath": DecorationArticulation,
+
+	"0": DecorationFingering, "1": DecorationFingering, "2": DecorationFingering, "3": DecorationFingering,
+	"4": DecorationFingering, "5": DecorationFingering, "+": DecorationFingering, "plus": DecorationFingering,
+	"open": DecorationFingering, "thumb": DecorationFingering,
+
+	"pppp": DecorationDynamic, "ppp": DecorationDynamic, "pp": DecorationDynamic, "p": DecorationDynamic,
+	"mp": DecorationDynamic, "mf": DecorationDynamic, "f": DecorationDynamic, "ff": DecorationDynamic,
+	"fff": DecorationDynamic, "ffff": DecorationDynamic, "sfz": DecorationDynamic,
+	"crescendo(": DecorationDynamic, "<(": DecorationDynamic, "crescendo)": DecorationDynamic, "<)": DecorationDynamic,
+	"diminuendo(": DecorationDynamic, ">(": DecorationDynamic, "diminuendo)": DecorationDynamic, ">)": DecorationDynamic,
+
+	"segno": DecorationNavigation, "coda": DecorationNavigation, "D.S.": DecorationNavigation,
+	"D.C.": DecorationNavigation, "dacoda": DecorationNavigation, "dacapo": DecorationNavigation,
+	"fine": DecorationNavigation,
+
+	"shortphrase": DecorationPhrase, "mediumphrase": DecorationPhrase, "longphrase": DecorationPhrase,
+}
+
+//defaultSymbols returns the definitions of the single characters that stand for a decoration,
+//unless a U: field defines them otherwise.
+func defaultSymbols() map[byte]string {
+	return map[byte]string{
+		'.': "!staccato!",
+		'~': "!roll!",
+		'H': "!fermata!",
+		'L': "!emphasis!",
+		'M': "!lowermordent!",
+		'O': "!coda!",
+		'P': "!uppermordent!",
+		'S': "!segno!",
+		'T': "!trill!",
+		'u': "!upbow!",
+		'v': "!downbow!",
+	}
+}
+
+//newDecoration returns the decoration with the given name, of which the type is unknown
+//if it is not in the abc standard.
+func newDecoration(name string) Decoration {
+	decoration := Decoration{Name: name, Type: decorationTypes[name]}
+	if decoration.Type == "" {
+		decoration.Type = DecorationUnknown
+	}
+	return decoration
+}
+
+//readDecoration reads a decoration between '!', which must be on a single line.
+//decoration ::= '!', {CHAR}, '!';
+func (d *Decoder) readDecoration() (Decoration, error) {
+	d.r.ReadByte() //skipping '!'
+	var name []byte
+	for {
+		b, err := d.r.Peek(1)
+		if err != nil || b[0] == '\n' {
+			return Decoration{}, errors.New("decoration is not closed by '!'")
+		}
+		d.r.ReadByte()
+		if b[0] == '!' {
+			break
+		}
+		name = append(name, b[0])
+	}
+	if len(name) == 0 {
+		return Decoration{}, errors.New("decoration has no name")
+	}
+	return newDecoration(string(name)), nil
+}
+
+//readSymbol reads a single character that stands for a decoration, like "T" for a trill,
+//and attaches what it is defined as to the next note.
+//A symbol defined as quoted text is an annotation or chord symbol.
+func (d *Decoder) readSymbol() {
+	symbol, _ := d.r.ReadByte()
+	definition := d.symbols[symbol]
+	name := definition[1 : len(definition)-1]
+	switch {
+	case definition[0] == '"':
+		d.attached.parseQuoted(name)
+	case name != "nil" && name != "none":
+		decoration := newDecoration(name)
+		decoration.Symbol = string(symbol)
+		d.attached.Decorations = append(d.attached.Decorations, decoration)
+	}
+}
+
+//String returns the decoration as written.
+func (d *Decoration) String() string {
+	if d.Symbol != "" {
+		return d.Symbol
+	}
+	return "!" + d.Name + "!"
+}
+
+//formatDecorations returns decorations as written in front of a note or barline.
+func formatDecorations(decorations []Decoration) string {
+	var sb strings.Builder
+	for i := range decorations {
+		sb.WriteString(decorations[i].String())
+	}
+	return sb.String()
+}
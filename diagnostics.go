@@ -0,0 +1,107 @@
+package abc
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+//Severity tells how serious a Diagnostic is.
+type Severity int
+
+//The severities of diagnostics, from least to most serious.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+//DiagnosticCode identifies the kind of problem a Diagnostic reports.
+type DiagnosticCode string
+
+//The codes used in diagnostics.
+const (
+	CodeNotABC        DiagnosticCode = "not-abc"
+	CodeOldVersion    DiagnosticCode = "old-version"
+	CodeSyntax        DiagnosticCode = "syntax"
+	CodeText          DiagnosticCode = "text"
+	CodeUnsupported   DiagnosticCode = "unsupported"
+	CodeUnexpectedEOF DiagnosticCode = "unexpected-eof"
+	CodeRead          DiagnosticCode = "read"
+)
+
+//Diagnostic is a message about a specific place in the decoded ABC file.
+//Line and Column start at 1, Column counts characters and Offset counts bytes.
+//Diagnostics with SeverityError are also returned as error.
+type Diagnostic struct {
+	Line     int            `json:"line"`
+	Column   int            `json:"column"`
+	Offset   int64          `json:"offset"`
+	Severity Severity       `json:"severity"`
+	Code     DiagnosticCode `json:"code"`
+	Message  string         `json:"message"`
+
+	cause error
+}
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+//Cause returns the underlying error, if any.
+func (d Diagnostic) Cause() error {
+	return d.cause
+}
+
+//report delivers a diagnostic to the handler of the decoder,
+//or collects it in Diagnostics if there is no handler.
+func (d *Decoder) report(diagnostic Diagnostic) {
+	if d.DiagnosticHandler != nil {
+		d.DiagnosticHandler(diagnostic)
+		return
+	}
+	d.Diagnostics = append(d.Diagnostics, diagnostic)
+}
+
+//diagnose reports a diagnostic at position p.
+func (d *Decoder) diagnose(p position, severity Severity, code DiagnosticCode, message string) {
+	d.report(newDiagnostic(p, severity, code, message))
+}
+
+//fail reports err as an error at position p and returns it as a Diagnostic.
+//errors that already are a Diagnostic are returned as they are.
+func (d *Decoder) fail(p position, code DiagnosticCode, err error) error {
+	if _, ok := err.(Diagnostic); ok {
+		return err
+	}
+	if errors.Cause(err) == io.EOF {
+		code = CodeUnexpectedEOF
+	}
+	diagnostic := newDiagnostic(p, SeverityError, code, err.Error())
+	diagnostic.cause = err
+	d.report(diagnostic)
+	return diagnostic
+}
+
+func newDiagnostic(p position, severity Severity, code DiagnosticCode, message string) Diagnostic {
+	return Diagnostic{
+		Line:     p.line,
+		Column:   p.column,
+		Offset:   p.offset,
+		Severity: severity,
+		Code:     code,
+		Message:  message,
+	}
+}
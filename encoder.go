@@ -0,0 +1,426 @@
+package abc
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//Encoder writes decoded tunes back to ABC notation.
+type Encoder struct {
+	w *bufio.Writer
+}
+
+//NewEncoder returns an encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+//Encode writes the version line, the file header and all tunes of the decoder.
+func (e *Encoder) Encode(d *Decoder) error {
+	version := "2.1"
+	if d.Version != 0 {
+		version = strconv.FormatFloat(float64(d.Version), 'f', -1, 32)
+	}
+	e.w.WriteString("%abc-" + version + "\n")
+
+	header := e.fileHeader(d)
+	if header != "" {
+		//the file header is followed by an empty line.
+		e.w.WriteString(header + "\n")
+	}
+
+	for i := range d.Tunes {
+		if i > 0 {
+			//tunes are separated by an empty line.
+			e.w.WriteString("\n")
+		}
+		e.writeTune(&d.Tunes[i], d.newTune(0))
+	}
+	return e.w.Flush()
+}
+
+//EncodeTune writes a single tune, without any version line or file header.
+//All fields of the tune are written, including those that came from a file header.
+func (e *Encoder) EncodeTune(t *Tune) error {
+	e.writeTune(t, &Tune{})
+	return e.w.Flush()
+}
+
+//fileHeader returns the information fields of the file header, one per line.
+func (e *Encoder) fileHeader(d *Decoder) string {
+	var sb strings.Builder
+	writeField(&sb, 'A', d.Area)
+	writeField(&sb, 'B', d.Book)
+	writeField(&sb, 'C', d.Composer)
+	writeField(&sb, 'D', d.Discography)
+	writeField(&sb, 'F', d.FileURL)
+	writeField(&sb, 'G', d.Group)
+	writeField(&sb, 'H', d.History)
+	writeField(&sb, 'L', formatFraction(d.UnitNoteLength))
+	writeField(&sb, 'M', formatMeter(d.Meter, d.MeterTop, d.MeterBottom))
+	writeDefinitions(&sb, 'm', macroDefinitions(d.Macro), nil)
+	writeField(&sb, 'N', d.NoteText)
+	writeField(&sb, 'O', d.Origin)
+	writeField(&sb, 'R', d.Rhythm)
+	writeField(&sb, 'r', d.Remark)
+	writeField(&sb, 'S', d.Source)
+	writeDefinitions(&sb, 'U', symbolDefinitions(d.UserDefined), nil)
+	writeField(&sb, 'W', d.Words)
+	writeField(&sb, 'Z', d.Transcription)
+	return sb.String()
+}
+
+//writeTune writes the tune header, starting with X: and T: and ending with K:,
+//followed by the tune body.
+//Fields that are equal to those of the file header h are not repeated.
+func (e *Encoder) writeTune(t *Tune, h *Tune) {
+	var sb strings.Builder
+	sb.WriteString("X:" + strconv.FormatUint(t.ReferenceNumber, 10) + "\n")
+	for _, title := range strings.Split(t.Title, "\n") {
+		sb.WriteString("T:" + strings.TrimSpace(title) + "\n")
+	}
+	writeField(&sb, 'A', notInherited(t.Area, h.Area))
+	writeField(&sb, 'B', notInherited(t.Book, h.Book))
+	writeField(&sb, 'C', notInherited(t.Composer, h.Composer))
+	writeField(&sb, 'D', notInherited(t.Discography, h.Discography))
+	writeField(&sb, 'F', notInherited(t.FileURL, h.FileURL))
+	writeField(&sb, 'G', notInherited(t.Group, h.Group))
+	writeField(&sb, 'H', notInherited(t.History, h.History))
+	writeField(&sb, 'L', notInherited(formatFraction(t.UnitNoteLength), formatFraction(h.UnitNoteLength)))
+	writeField(&sb, 'M', notInherited(formatMeter(t.Meter, t.MeterTop, t.MeterBottom), formatMeter(h.Meter, h.MeterTop, h.MeterBottom)))
+	writeDefinitions(&sb, 'm', macroDefinitions(t.Macro), macroDefinitions(h.Macro))
+	writeField(&sb, 'N', notInherited(t.NoteText, h.NoteText))
+	writeField(&sb, 'O', notInherited(t.Origin, h.Origin))
+	writeField(&sb, 'P', t.Parts.String())
+	if t.Tempo != nil {
+		writeField(&sb, 'Q', t.Tempo.String())
+	}
+	writeField(&sb, 'R', notInherited(t.Rhythm, h.Rhythm))
+	writeField(&sb, 'r', notInherited(t.Remark, h.Remark))
+	writeField(&sb, 'S', notInherited(t.Source, h.Source))
+	writeDefinitions(&sb, 'U', symbolDefinitions(t.UserDefined), symbolDefinitions(h.UserDefined))
+	for i := range t.Voices {
+		writeField(&sb, 'V', t.Voices[i].definition())
+	}
+	writeField(&sb, 'Z', notInherited(t.Transcription, h.Transcription))
+	sb.WriteString("K:" + t.Key.String() + "\n")
+
+	writeBody(&sb, encodeMeasures(t.Measures))
+	for i := range t.Voices {
+		if t.Voices[i].Measures != nil {
+			sb.WriteString("V:" + t.Voices[i].ID + "\n")
+			writeBody(&sb, encodeMeasures(t.Voices[i].Measures))
+		}
+	}
+	writeField(&sb, 'W', notInherited(t.Words, h.Words))
+	e.w.WriteString(sb.String())
+}
+
+//writeBody writes the music of a tune body or voice, which always ends with a lineFeed.
+func writeBody(sb *strings.Builder, body string) {
+	sb.WriteString(body)
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		sb.WriteString("\n")
+	}
+}
+
+//writeField writes an information field if it has a value.
+//Values spanning multiple lines are continued using "+:".
+func writeField(sb *strings.Builder, field byte, value string) {
+	if value == "" {
+		return
+	}
+	for i, line := range strings.Split(value, "\n") {
+		if i == 0 {
+			sb.WriteByte(field)
+		} else {
+			sb.WriteByte('+')
+		}
+		sb.WriteString(":" + line + "\n")
+	}
+}
+
+//writeDefinitions writes a field for each definition of a user defined symbol or macro,
+//except for those at the start that are the same as in the file header.
+func writeDefinitions(sb *strings.Builder, field byte, definitions []string, header []string) {
+	inherited := 0
+	for inherited < len(header) && inherited < len(definitions) && definitions[inherited] == header[inherited] {
+		inherited++
+	}
+	for _, definition := range definitions[inherited:] {
+		writeField(sb, field, definition)
+	}
+}
+
+//symbolDefinitions returns the user defined symbols as written in U: fields.
+func symbolDefinitions(symbols []UserSymbol) []string {
+	definitions := make([]string, len(symbols))
+	for i := range symbols {
+		definitions[i] = symbols[i].String()
+	}
+	return definitions
+}
+
+//macroDefinitions returns the macros as written in m: fields.
+func macroDefinitions(macros []Macro) []string {
+	definitions := make([]string, len(macros))
+	for i := range macros {
+		definitions[i] = macros[i].String()
+	}
+	return definitions
+}
+
+//notInherited returns the value of a tune field, or nothing if it is the same as in the file header.
+func notInherited(value, header string) string {
+	if value == header {
+		return ""
+	}
+	return value
+}
+
+//formatFraction returns a fraction like 1/8, or nothing if it is zero.
+func formatFraction(f Fraction) string {
+	if f.Numerator == 0 {
+		return ""
+	}
+	return f.String()
+}
+
+//formatMeter returns the meter as written in an M: field.
+//Without a Meter, it is written from its top and bottom, if there are any.
+func formatMeter(meter *Meter, top, bottom uint64) string {
+	if meter != nil {
+		return meter.String()
+	}
+	if top == 0 || bottom == 0 {
+		return ""
+	}
+	return strconv.FormatUint(top, 10) + "/" + strconv.FormatUint(bottom, 10)
+}
+
+//encodeMeasures writes the music of a tune body.
+//measures are separated by the barline that ends the one and starts the other.
+func encodeMeasures(measures []Measure) string {
+	var sb strings.Builder
+	var tuplets []tupletState
+	var macro *MacroUse
+	for i := range measures {
+		m := &measures[i]
+		if i > 0 {
+			sb.WriteString(formatBarlineAttached(&measures[i-1]))
+			sb.WriteString(formatBarline(&measures[i-1], m))
+		} else if m.RepeatStart || m.ThickStart || m.BarlineStart || m.Barline != "" {
+			sb.WriteString(formatBarline(&Measure{}, m))
+		}
+		sb.WriteString(formatEnding(m))
+		if meter := formatMeter(m.Meter, m.MeterTop, m.MeterBottom); meter != "" {
+			sb.WriteString("[M:" + meter + "]")
+		}
+		for j := range m.NoteGroups {
+			ng := &m.NoteGroups[j]
+			for k, u := range ng.Units {
+				macro = nextMacro(&sb, m, macro, j, k)
+				tuplet := formatTuplets(ng, k, &tuplets)
+				if macro == nil {
+					sb.WriteString(tuplet)
+				}
+				if field, ok := u.(*Field); ok && (field.Line || macro != nil) {
+					//a field on its own line
+					if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+						sb.WriteString("\n")
+					}
+					sb.WriteString(field.Name + ":" + field.Value + "\n")
+					continue
+				}
+				//notes in a tuplet are written with the duration they have without it.
+				scale := NewFraction(1, 1)
+				switch u.(type) {
+				case *Note, *Rest, *Chord:
+					scale, tuplets = nextTupletScale(tuplets)
+				}
+				if macro == nil {
+					sb.WriteString(formatUnit(u, scale))
+				}
+			}
+			macro = nextMacro(&sb, m, macro, j, len(ng.Units))
+			tuplet := formatTuplets(ng, len(ng.Units), &tuplets)
+			if macro == nil {
+				sb.WriteString(tuplet)
+			}
+			if ng.LineBreak {
+				sb.WriteString("\n")
+			} else if j < len(m.NoteGroups)-1 && macro == nil {
+				sb.WriteString(" ")
+			}
+		}
+	}
+	if len(measures) == 0 {
+		return ""
+	}
+	last := &measures[len(measures)-1]
+	end := formatBarlineAttached(last)
+	if last.RepeatEnd || last.ThickEnd {
+		end += formatBarline(last, &Measure{})
+	}
+	//the end of the music is written on its last line.
+	music := sb.String()
+	if strings.HasSuffix(music, "\n") {
+		return strings.TrimSuffix(music, "\n") + end + "\n"
+	}
+	return music + end
+}
+
+//nextMacro writes the macros that start at unit k of notegroup j of a measure.
+//It returns the macro that the unit is written with, or nil if the unit is not written with a macro.
+//The units of a macro, and the spaces between them, are not written themselves.
+func nextMacro(sb *strings.Builder, m *Measure, macro *MacroUse, j, k int) *MacroUse {
+	if macro != nil && macro.contains(j, k) {
+		return macro
+	}
+	macro = nil
+	for i := range m.Macros {
+		use := &m.Macros[i]
+		if use.Group == j && use.Start == k {
+			sb.WriteString(use.Text)
+			if macro == nil && use.contains(j, k) {
+				macro = use
+			}
+		}
+	}
+	return macro
+}
+
+//formatTuplets returns the tuplets that start at the unit with the given index in a notegroup.
+//Tuplets that start after the last unit are written at its end.
+//The tuplets are started in active.
+func formatTuplets(ng *NoteGroup, unit int, active *[]tupletState) string {
+	tuplets := ""
+	for i := range ng.Tuplets {
+		start := ng.Tuplets[i].Start
+		if start == unit || (unit == len(ng.Units) && start > unit) {
+			tuplets += ng.Tuplets[i].String()
+			*active = append(*active, ng.Tuplets[i].state())
+		}
+	}
+	return tuplets
+}
+
+//formatBarline returns the barline between two consecutive measures.
+//Without the barline as written, it follows from the repeats and thick lines of the measures.
+func formatBarline(prev, next *Measure) string {
+	if next.Barline != "" {
+		return next.Barline
+	}
+	barline := ""
+	if prev.RepeatEnd {
+		barline += ":"
+	}
+	switch {
+	case prev.ThickEnd && next.ThickStart:
+		barline += "|][|"
+	case prev.ThickEnd:
+		barline += "|]"
+	case next.ThickStart:
+		barline += "[|"
+	case next.BarlineStart:
+		barline += "||"
+	default:
+		barline += "|"
+	}
+	if next.RepeatStart {
+		barline += ":"
+	}
+	return barline
+}
+
+//formatUnit returns a unit as written in the tune body, with what is attached to it in front.
+//The duration is written as if it was not scaled by the tuplets the unit is part of.
+func formatUnit(u Unit, tuplet Fraction) string {
+	if chord, ok := u.(*Chord); ok && len(chord.notes) == 0 {
+		//a chord without notes can not be written, so it is skipped.
+		return ""
+	}
+	if a, ok := u.(attacher); ok {
+		return formatAttached(a.attached()) + formatBareUnit(u, tuplet) + strings.Repeat(")", a.attached().SlurEnd)
+	}
+	return formatBareUnit(u, tuplet)
+}
+
+//formatAttached returns the slurs, grace notes, chord symbol, annotations and decorations in front of a note, rest or chord.
+func formatAttached(a *Attached) string {
+	var sb strings.Builder
+	sb.WriteString(strings.Join(a.SlurStarts, ""))
+	if a.GraceNotes != nil {
+		sb.WriteString(a.GraceNotes.String())
+	}
+	if a.ChordSymbol != nil {
+		sb.WriteString(`"` + a.ChordSymbol.String() + `"`)
+	}
+	for _, annotation := range a.Annotations {
+		sb.WriteString(`"` + annotation.Placement + annotation.Text + `"`)
+	}
+	sb.WriteString(formatDecorations(a.Decorations))
+	return sb.String()
+}
+
+//formatBarlineAttached returns the text and decorations in front of the barline that ends measure m.
+func formatBarlineAttached(m *Measure) string {
+	return formatAttached(&Attached{ChordSymbol: m.ChordSymbol, Annotations: m.Annotations, Decorations: m.Decorations})
+}
+
+//formatBareUnit returns a unit as written in the tune body.
+func formatBareUnit(u Unit, tuplet Fraction) string {
+	switch unit := u.(type) {
+	case *Note:
+		pitch := unit.Value
+		if unit.Step != "" {
+			pitch = formatPitch(unit.Step, unit.Octave)
+		}
+		if unit.Accidental != nil {
+			pitch = unit.Accidental.String() + pitch
+		}
+		switch {
+		case unit.TieStart && unit.TieDotted:
+			return pitch + formatDuration(unit.Duration.Div(tuplet)) + ".-"
+		case unit.TieStart:
+			return pitch + formatDuration(unit.Duration.Div(tuplet)) + "-"
+		}
+		return pitch + formatDuration(unit.Duration.Div(tuplet))
+	case *Field:
+		return unit.GetValue()
+	case *Rest:
+		if unit.Measures > 1 {
+			return unit.GetValue() + strconv.Itoa(unit.Measures)
+		} else if unit.Measures == 1 {
+			return unit.GetValue()
+		}
+		return unit.GetValue() + formatDuration(unit.Duration.Div(tuplet))
+	case *Chord:
+		//the notes are written with their full duration, so a length after the chord
+		//is only needed when the chord does not last as long as its first note.
+		chord := "["
+		for i := range unit.notes {
+			chord += formatUnit(&unit.notes[i], tuplet)
+		}
+		return chord + "]" + formatDuration(unit.Duration.Div(unit.notes[0].Duration))
+	default:
+		return u.GetValue() + formatDuration(u.GetDuration().Div(tuplet))
+	}
+}
+
+//formatDuration returns the length of a note as written after it,
+//which is empty for a duration of 1.
+func formatDuration(duration Fraction) string {
+	duration = duration.normalized()
+	switch {
+	case duration.Numerator == duration.Denominator:
+		return ""
+	case duration.Denominator == 1:
+		return strconv.FormatInt(duration.Numerator, 10)
+	case duration.Numerator == 1:
+		return "/" + strconv.FormatInt(duration.Denominator, 10)
+	}
+	return duration.String()
+}
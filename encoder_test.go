@@ -0,0 +1,91 @@
+package abc
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//encode decodes all tunes of an abc file and encodes them again.
+func encode(t *testing.T, in string) (string, *Decoder) {
+	t.Helper()
+	d := NewDecoder(*bufio.NewReader(strings.NewReader(in)), false)
+	if err := d.Decode(); err != nil {
+		t.Fatalf("decoding %q: %v", in, err)
+	}
+	var sb strings.Builder
+	if err := NewEncoder(&sb).Encode(d); err != nil {
+		t.Fatalf("encoding %q: %v", in, err)
+	}
+	return sb.String(), d
+}
+
+func TestEncoderRoundTrip(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		body string
+	}{
+		{"notes", "K:C\nA,B,C D|e'f'g a|\n"},
+		{"lengths", "M:6/8\nL:1/8\nK:Gmix\nA>B c<d|A3/2 z/ x4|Z2|\n"},
+		{"chords", "K:C\n\"Am\"[CEG]2 \"^above\"[C/E/]c|\n"},
+		{"tuplets", "K:C\n(3abc (3:2:4abcd|(5:4abcde|\n"},
+		{"grace notes", "K:C\n{g}a{/ag}b|\n"},
+		{"decorations", "K:C\n!trill!a .b ~c Hd|\n"},
+		{"ties and slurs", "K:C\na-a (bc)|\n"},
+		{"text before barlines", "K:C\nabc\"Fine\"|d\"^x\"\"G\"!fermata!|e\"D.C.\"\n"},
+		{"text at the end", "K:C\nV:1\nabc|\"Fine\"\nV:2\ndef\"_end\"|]\n"},
+		{"barlines", "K:C\n|:abc:|[1d:|[2e||[|f|]\n"},
+		{"inline fields", "K:C\na[K:D]b[L:1/16]c|\n"},
+		{"voices", "Q:1/4=120\nK:C\nV:1\nabc|\nV:2\ndef|\n"},
+		{"key modifiers", "K:Ddor clef=bass\nabc|\n"},
+		{"unknown key modifiers", "K:Dlyd stafflines=4\nabc|\n"},
+		{"parts", "P:AB2\nK:C\nP:A\nabc|\nP:B\ndef|\n"},
+		{"symbols", "U:T=!trill!\nK:C\nTa Tb|\n"},
+		{"macros", "m:~n2=o/n/o/\nK:C\n~a2 b|\n"},
+		{"macro without units", "m:Wa=!trill!\nK:C\nWa b|\n"},
+		{"macro before a barline", "m:Wa=!trill!\nK:C\nbWa|c|\n"},
+		{"decorated macro", "m:~n2=o/n/o/\nK:C\n!trill!~a2 b|\n"},
+		{"macro with broken rhythm", "m:W=a>\nK:C\nWb c|\n"},
+		{"words", "K:C\nabc|\nW:line one\n+:line two\n"},
+	} {
+		in := "%abc-2.1\n\nX:1\nT:" + c.name + "\n" + c.body
+		out, first := encode(t, in)
+		again, d := encode(t, out)
+		if !reflect.DeepEqual(d.Tunes, first.Tunes) {
+			t.Errorf("%s: decoding %q gives another tune than %q", c.name, out, in)
+		}
+		if again != out {
+			t.Errorf("%s: encoding is not stable:\n%s\nbecomes\n%s", c.name, out, again)
+		}
+		if len(d.Diagnostics) != len(first.Diagnostics) {
+			t.Errorf("%s: decoding %q: %v", c.name, out, d.Diagnostics)
+		}
+	}
+}
+
+func TestEncodeChord(t *testing.T) {
+	one := NewFraction(1, 1)
+	c := Note{Value: "C", Step: "C", Octave: 4, Duration: one, UnitNoteLength: NewFraction(1, 8)}
+	e, g := c, c
+	e.Value, e.Step = "E", "E"
+	g.Value, g.Step = "G", "G"
+	for _, chord := range []struct {
+		chord *Chord
+		want  string
+	}{
+		{NewChord(c, e, g), "[CEG]"},
+		{NewChord(), ""},
+		{&Chord{Value: "CEG", Duration: one}, ""},
+	} {
+		tune := &Tune{ReferenceNumber: 1, Title: "t", Measures: []Measure{{NoteGroups: []NoteGroup{{Units: []Unit{chord.chord}}}}}}
+		var sb strings.Builder
+		if err := NewEncoder(&sb).EncodeTune(tune); err != nil {
+			t.Fatal(err)
+		}
+		body := sb.String()[strings.Index(sb.String(), "K:\n")+3:]
+		if strings.TrimSuffix(body, "\n") != chord.want {
+			t.Errorf("%q: got %q", chord.want, sb.String())
+		}
+	}
+}
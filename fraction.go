@@ -0,0 +1,122 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Fraction is an exact rational number, such as the duration of a note or a microtonal alteration.
+//Fractions made with NewFraction are always reduced and have a positive denominator.
+type Fraction struct {
+	Numerator   int64 `json:"numerator"`
+	Denominator int64 `json:"denominator"`
+}
+
+//NewFraction returns the reduced fraction numerator/denominator.
+func NewFraction(numerator, denominator int64) Fraction {
+	if denominator < 0 {
+		numerator, denominator = -numerator, -denominator
+	}
+	if g := gcd(numerator, denominator); g > 1 {
+		numerator /= g
+		denominator /= g
+	}
+	return Fraction{Numerator: numerator, Denominator: denominator}
+}
+
+//normalized returns the fraction with a zero denominator counting as 1.
+func (f Fraction) normalized() Fraction {
+	if f.Denominator == 0 {
+		return Fraction{Numerator: f.Numerator, Denominator: 1}
+	}
+	return f
+}
+
+//Add returns f + g.
+func (f Fraction) Add(g Fraction) Fraction {
+	f, g = f.normalized(), g.normalized()
+	return NewFraction(f.Numerator*g.Denominator+g.Numerator*f.Denominator, f.Denominator*g.Denominator)
+}
+
+//Sub returns f - g.
+func (f Fraction) Sub(g Fraction) Fraction {
+	g = g.normalized()
+	return f.Add(Fraction{Numerator: -g.Numerator, Denominator: g.Denominator})
+}
+
+//Mul returns f * g.
+func (f Fraction) Mul(g Fraction) Fraction {
+	f, g = f.normalized(), g.normalized()
+	return NewFraction(f.Numerator*g.Numerator, f.Denominator*g.Denominator)
+}
+
+//Div returns f / g. Dividing by zero returns zero.
+func (f Fraction) Div(g Fraction) Fraction {
+	f, g = f.normalized(), g.normalized()
+	if g.Numerator == 0 {
+		return NewFraction(0, 1)
+	}
+	return NewFraction(f.Numerator*g.Denominator, f.Denominator*g.Numerator)
+}
+
+//Cmp returns -1, 0 or 1 when f is smaller than, equal to or larger than g.
+func (f Fraction) Cmp(g Fraction) int {
+	difference := f.Sub(g).Numerator
+	switch {
+	case difference < 0:
+		return -1
+	case difference > 0:
+		return 1
+	}
+	return 0
+}
+
+//Float64 returns the fraction as a float. A zero denominator counts as 1.
+func (f Fraction) Float64() float64 {
+	if f.Denominator == 0 {
+		return float64(f.Numerator)
+	}
+	return float64(f.Numerator) / float64(f.Denominator)
+}
+
+//String returns the fraction as "n/d", or just "n" for whole numbers.
+func (f Fraction) String() string {
+	if f.Denominator == 1 || f.Denominator == 0 {
+		return strconv.FormatInt(f.Numerator, 10)
+	}
+	return strconv.FormatInt(f.Numerator, 10) + "/" + strconv.FormatInt(f.Denominator, 10)
+}
+
+func gcd(a, b int64) int64 {
+	if a < 0 {
+		a = -a
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+//parseFraction reads a fraction written as "n/d" or "n".
+func parseFraction(s string) (Fraction, error) {
+	s = strings.TrimSpace(s)
+	divisor := strings.IndexByte(s, '/')
+	if divisor == -1 {
+		numerator, err := strconv.ParseInt(s, 10, 64)
+		return NewFraction(numerator, 1), err
+	}
+	numerator, err := strconv.ParseInt(strings.TrimSpace(s[:divisor]), 10, 64)
+	if err != nil {
+		return Fraction{}, err
+	}
+	denominator, err := strconv.ParseInt(strings.TrimSpace(s[divisor+1:]), 10, 64)
+	if err != nil {
+		return Fraction{}, err
+	}
+	if denominator == 0 {
+		return Fraction{}, errors.New("fraction can not have a zero denominator")
+	}
+	return NewFraction(numerator, denominator), nil
+}
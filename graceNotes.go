@@ -0,0 +1,62 @@
+package abc
+
+import (
+	"github.com/pkg/errors"
+)
+
+//GraceNotes are the short ornamental notes written in braces in front of a note, like "{g}" or "{gag}".
+//They take no time in the measure, their durations are as written, in unit note lengths.
+//An acciaccatura, written like "{/g}", is played as short as possible.
+type GraceNotes struct {
+	Acciaccatura bool   `json:"acciaccatura,omitempty"`
+	Notes        []Note `json:"notes"`
+}
+
+//readGraceNotes reads the grace notes between braces.
+//graceNotes ::= '{', ['/'], note, {note}, '}';
+func (d *Decoder) readGraceNotes() (*GraceNotes, error) {
+	d.r.ReadByte() //skipping '{'
+	grace := &GraceNotes{}
+	if b, err := d.r.Peek(1); err == nil && b[0] == '/' {
+		grace.Acciaccatura = true
+		d.r.ReadByte()
+	}
+	//a tie goes over the grace notes to the principal note.
+	ties := d.ties
+	d.ties = nil
+	defer func() { d.ties = ties }()
+	for {
+		b, err := peekLexToken(d.r)
+		if err != nil {
+			return nil, errors.Wrap(err, "grace notes are not closed by '}'")
+		}
+		if b.token[0] == '}' {
+			d.r.ReadByte()
+			break
+		}
+		if !b.isPitch() {
+			return nil, errors.Errorf("unexpected character %q in grace notes", d.r.peekRune())
+		}
+		note, err := d.readNote()
+		if err != nil {
+			return nil, err
+		}
+		grace.Notes = append(grace.Notes, *note)
+	}
+	if len(grace.Notes) == 0 {
+		return nil, errors.New("grace notes have no notes")
+	}
+	return grace, nil
+}
+
+//String returns the grace notes as written, with the braces.
+func (g *GraceNotes) String() string {
+	grace := "{"
+	if g.Acciaccatura {
+		grace += "/"
+	}
+	for i := range g.Notes {
+		grace += formatUnit(&g.Notes[i], NewFraction(1, 1))
+	}
+	return grace + "}"
+}
@@ -1,9 +1,7 @@
 package abc
 
 import (
-	"fmt"
 	"strconv"
-	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -18,6 +16,7 @@ func (d *Decoder) readInformationField(inline bool) error {
 	//the instructions may also change the Decoder structure to advance through the tunes in the file.
 	//therefore, they are checked on top.
 	d.skipComments()
+	start := d.r.pos
 	fullLine := ""
 	var err error = nil
 	if !inline {
@@ -26,11 +25,14 @@ func (d *Decoder) readInformationField(inline bool) error {
 		fullLine, err = d.readInline()
 	}
 	if err != nil {
-		return err
+		return d.fail(start, CodeRead, err)
+	}
+	if len(fullLine) < 2 {
+		return nil //empty line, nothing to read
 	}
 	informationCharacter := fullLine[0]
 	if fullLine[1] != ':' {
-		fmt.Printf("found text!")
+		d.diagnose(start, SeverityWarning, CodeText, "skipping text that is not an information field")
 		return nil //this probably was some kind of text...
 	}
 	line := string(fullLine[2:len(fullLine)]) //skipping ":"
@@ -41,68 +43,149 @@ func (d *Decoder) readInformationField(inline bool) error {
 
 	//K: key                <instruction>
 	case "K":
-		d.tuneHeaderDone = true
-		d.Tunes[len(d.Tunes)-1].Key = line
+		if d.inFileHeader {
+			return d.fail(start, CodeSyntax, errors.New("key field is not allowed in the file header"))
+		}
+		//a key that is not properly formatted still ends the tune header.
+		key, keyErr := parseKey(line)
+		if !d.tuneHeaderDone {
+			if d.tune.UnitNoteLength.Numerator == 0 {
+				d.tune.UnitNoteLength = defaultUnitNoteLength(d.tune.MeterTop, d.tune.MeterBottom)
+			}
+			d.tune.Key = key
+			d.voiceState = d.tuneHeaderState()
+			d.tuneHeaderDone = true
+		} else {
+			//a change of key in the tune body
+			d.addUnit(&Field{Name: "K", Value: line, Line: !inline, Key: &key})
+		}
+		d.setKey(&key)
+		for _, word := range key.Unknown {
+			d.diagnose(start, SeverityWarning, CodeUnsupported, "unknown key modifier "+strconv.Quote(word))
+		}
+		if keyErr != nil {
+			return d.fail(start, CodeSyntax, errors.Wrap(keyErr, "key not properly formatted"))
+		}
 
 	//L: unit note length   <instruction>
 	case "L":
+		length, err := parseFraction(line)
+		if err != nil || length.Numerator <= 0 {
+			return d.fail(start, CodeSyntax, errors.New("unit note length not properly formatted"))
+		}
+		if d.inFileHeader {
+			d.UnitNoteLength = length
+		} else if !d.tuneHeaderDone {
+			d.tune.UnitNoteLength = length
+		} else {
+			d.unitNoteLength = length
+			d.addUnit(&Field{Name: "L", Value: line, Line: !inline})
+		}
 
 	//M: meter              <instruction>
 	case "M":
-		divisor := strings.IndexByte(line, '/')
-		if divisor == -1 {
-			return errors.New("Meter not properly formatted")
-		}
-		top, err := strconv.ParseUint(line[0:divisor], 10, 64)
+		meter, err := parseMeter(line)
 		if err != nil {
-			return err
-		}
-		bottom, err := strconv.ParseUint(line[divisor+1:], 10, 64)
-		if err != nil {
-			return err
+			return d.fail(start, CodeSyntax, errors.Wrap(err, "Meter not properly formatted"))
 		}
+		top, bottom := meter.Top(), meter.Bottom
 
 		if d.inFileHeader {
+			d.Meter = &meter
 			d.MeterTop = top
 			d.MeterBottom = bottom
 
 		} else {
-			current := &d.Tunes[len(d.Tunes)-1]
+			current := d.tune
 
 			if !d.tuneHeaderDone {
+				current.Meter = &meter
 				current.MeterTop = top
 				current.MeterBottom = bottom
 			} else {
-				current.Measures[len(current.Measures)-1].MeterTop = top
-				current.Measures[len(current.Measures)-1].MeterBottom = bottom
+				d.meter = &meter
+				d.currentMeasure().Meter = &meter
+				d.currentMeasure().MeterTop = top
+				d.currentMeasure().MeterBottom = bottom
 			}
 		}
 
 	//m: macro              <instruction>
 	case "m":
+		if d.tuneHeaderDone {
+			d.diagnose(start, SeverityWarning, CodeUnsupported, "macro field is not allowed in the tune body")
+			break
+		}
+		err := d.readMacroField(line)
+		if err != nil {
+			return d.fail(start, CodeSyntax, errors.Wrap(err, "macro not properly formatted"))
+		}
 
 	//Q: tempo              <instruction>
 	case "Q":
+		tempo, err := parseTempo(line)
+		if err != nil {
+			return d.fail(start, CodeSyntax, errors.Wrap(err, "tempo not properly formatted"))
+		}
+		if d.inFileHeader {
+			d.diagnose(start, SeverityWarning, CodeUnsupported, "tempo is not allowed in the file header")
+		} else if !d.tuneHeaderDone {
+			d.tune.Tempo = &tempo
+		} else {
+			//a change of tempo in the tune body
+			d.addUnit(&Field{Name: "Q", Value: line, Line: !inline, Tempo: &tempo})
+		}
 
 	//s: symbol line        <instruction>
 	case "s":
 
 	//U: user defined       <instruction>
 	case "U":
+		err := d.readUserSymbol(line, inline)
+		if err != nil {
+			return d.fail(start, CodeSyntax, errors.Wrap(err, "user defined symbol not properly formatted"))
+		}
 
 	//X: reference number   <instruction>
 	case "X":
+		if inline || d.tune != nil {
+			//the tune that is being decoded is not replaced.
+			return d.fail(start, CodeSyntax, errors.New("reference number is only allowed at the start of a tune"))
+		}
 		d.tuneHeaderDone = false
 		num, err := strconv.ParseInt(line, 10, 64)
 		if err != nil {
-			return errors.Wrap(err, "reference number of tune could not be parsed")
+			//the tune still starts here, even without a proper reference number.
+			d.tune = d.newTune(0)
+			return d.fail(start, CodeSyntax, errors.Wrap(err, "reference number of tune could not be parsed"))
 		}
-		d.Tunes = append(d.Tunes, Tune{ReferenceNumber: uint64(num)})
+		d.tune = d.newTune(uint64(num))
 	//V: voice              <instruction>
 	case "V":
+		if d.inFileHeader {
+			d.diagnose(start, SeverityWarning, CodeUnsupported, "voice is not allowed in the file header")
+			return nil
+		}
+		voice, err := parseVoice(line)
+		if err != nil {
+			return d.fail(start, CodeSyntax, errors.Wrap(err, "voice not properly formatted"))
+		}
+		d.setVoice(&voice)
 
 	//P: parts              <instruction>
 	case "P":
+		if d.inFileHeader {
+			d.diagnose(start, SeverityWarning, CodeUnsupported, "parts are not allowed in the file header")
+		} else if !d.tuneHeaderDone {
+			parts, err := parsePartOrder(line)
+			if err != nil {
+				return d.fail(start, CodeSyntax, errors.Wrap(err, "parts not properly formatted"))
+			}
+			d.tune.Parts = parts
+		} else {
+			//the start of a part in the tune body
+			d.addUnit(&Field{Name: "P", Value: line, Line: !inline})
+		}
 
 	//+ continuation character!
 	case "+":
@@ -111,18 +194,22 @@ func (d *Decoder) readInformationField(inline bool) error {
 			if d.inFileHeader {
 				d.Discography += "\n" + line
 			} else {
-				d.Tunes[len(d.Tunes)-1].Discography += "\n" + line
+				d.tune.Discography += "\n" + line
 			}
 		case "H":
 			if d.inFileHeader {
 				d.History += "\n" + line
 			} else {
-				d.Tunes[len(d.Tunes)-1].History += "\n" + line
+				d.tune.History += "\n" + line
 			}
 		case "W":
 			fallthrough
 		case "w":
-			d.Tunes[len(d.Tunes)-1].Words += "\n" + line
+			if d.inFileHeader {
+				d.Words += "\n" + line
+			} else {
+				d.tune.Words += "\n" + line
+			}
 
 		}
 
@@ -131,7 +218,7 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.Area = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Area = line
+			d.tune.Area = line
 		}
 
 	//B: book
@@ -139,7 +226,7 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.Book = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Book = line
+			d.tune.Book = line
 		}
 
 	//C: composer
@@ -147,7 +234,7 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.Composer = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Composer = line
+			d.tune.Composer = line
 		}
 
 	//D: discography
@@ -156,21 +243,21 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.Discography = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Discography = line
+			d.tune.Discography = line
 		}
 	//F: file url
 	case "F":
 		if d.inFileHeader {
 			d.FileURL = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].FileURL = line
+			d.tune.FileURL = line
 		}
 	//G: group
 	case "G":
 		if d.inFileHeader {
 			d.Group = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Group = line
+			d.tune.Group = line
 		}
 	//H: history
 	case "H":
@@ -178,7 +265,7 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.History = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].History = line
+			d.tune.History = line
 		}
 
 	//N: notes
@@ -186,14 +273,14 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.NoteText = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].NoteText = line
+			d.tune.NoteText = line
 		}
 	//O: origin
 	case "O":
 		if d.inFileHeader {
 			d.Origin = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Origin = line
+			d.tune.Origin = line
 		}
 
 	//R: rhythm
@@ -201,28 +288,30 @@ func (d *Decoder) readInformationField(inline bool) error {
 		if d.inFileHeader {
 			d.Rhythm = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Rhythm = line
+			d.tune.Rhythm = line
 		}
 	//r: remark
 	case "r":
 		if d.inFileHeader {
 			d.Remark = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Remark = line
+			d.tune.Remark = line
 		}
 	//S: source
 	case "S":
 		if d.inFileHeader {
 			d.Source = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Source = line
+			d.tune.Source = line
 		}
 	//T: tune title
 	case "T":
-		if d.Tunes[len(d.Tunes)-1].Title == "" {
-			d.Tunes[len(d.Tunes)-1].Title = line
+		if d.inFileHeader {
+			d.diagnose(start, SeverityWarning, CodeUnsupported, "title is not allowed in the file header")
+		} else if d.tune.Title == "" {
+			d.tune.Title = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Title += " \n" + line
+			d.tune.Title += " \n" + line
 		}
 
 	//W: words
@@ -231,13 +320,17 @@ func (d *Decoder) readInformationField(inline bool) error {
 		fallthrough
 	case "w":
 		d.lastInformationField = string(informationCharacter)
-		d.Tunes[len(d.Tunes)-1].Words = line
+		if d.inFileHeader {
+			d.Words = line
+		} else {
+			d.tune.Words = line
+		}
 	//Z: transcription
 	case "Z":
 		if d.inFileHeader {
 			d.Transcription = line
 		} else {
-			d.Tunes[len(d.Tunes)-1].Transcription = line
+			d.tune.Transcription = line
 		}
 	}
 
@@ -246,3 +339,50 @@ func (d *Decoder) readInformationField(inline bool) error {
 
 	return nil
 }
+
+//newTune returns a tune with the fields of the file header applied,
+//as they hold for every tune in the file.
+func (d *Decoder) newTune(referenceNumber uint64) *Tune {
+	return &Tune{
+		ReferenceNumber: referenceNumber,
+		Area:            d.Area,
+		Book:            d.Book,
+		Composer:        d.Composer,
+		Discography:     d.Discography,
+		FileURL:         d.FileURL,
+		Group:           d.Group,
+		History:         d.History,
+		UnitNoteLength:  d.UnitNoteLength,
+		Meter:           d.Meter,
+		MeterTop:        d.MeterTop,
+		MeterBottom:     d.MeterBottom,
+		Macro:           append([]Macro(nil), d.Macro...),
+		NoteText:        d.NoteText,
+		Origin:          d.Origin,
+		Rhythm:          d.Rhythm,
+		Remark:          d.Remark,
+		Source:          d.Source,
+		UserDefined:     append([]UserSymbol(nil), d.UserDefined...),
+		Words:           d.Words,
+		Transcription:   d.Transcription,
+	}
+}
+
+//defaultUnitNoteLength returns the unit note length of a tune without L: field.
+//It is 1/16 for meters below 3/4 and 1/8 for all others, including no meter at all.
+func defaultUnitNoteLength(meterTop, meterBottom uint64) Fraction {
+	if meterBottom != 0 && NewFraction(int64(meterTop), int64(meterBottom)).Cmp(NewFraction(3, 4)) < 0 {
+		return NewFraction(1, 16)
+	}
+	return NewFraction(1, 8)
+}
+
+//setKey changes the key signature and transposition of the music that follows, as far as the key sets them.
+func (d *Decoder) setKey(k *Key) {
+	if k.HasSignature() {
+		d.signature = k.Signature()
+	}
+	if k.HasTransposition() {
+		d.transpose = k.semitones()
+	}
+}
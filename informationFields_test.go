@@ -0,0 +1,47 @@
+package abc
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestUnitNoteLength(t *testing.T) {
+	for _, c := range []struct {
+		fileHeader string
+		header     string
+		length     string
+		absolute   string
+	}{
+		{"", "", "1/8", "3/16"},
+		{"", "M:2/4\n", "1/16", "3/32"},
+		{"", "M:3/4\n", "1/8", "3/16"},
+		{"", "M:6/8\n", "1/8", "3/16"},
+		{"", "M:C|\n", "1/8", "3/16"},
+		{"", "M:none\n", "1/8", "3/16"},
+		{"", "M:2/4\nL:1/4\n", "1/4", "3/8"},
+		{"L:1/4\n", "", "1/4", "3/8"},
+		{"L:1/4\n", "L:1/2\n", "1/2", "3/4"},
+		{"M:2/4\n", "", "1/16", "3/32"},
+		{"L:1/4\n", "M:2/4\n", "1/4", "3/8"},
+	} {
+		in := "%abc-2.1\n"
+		if c.fileHeader != "" {
+			in += c.fileHeader + "\n"
+		}
+		in += "X:1\nT:t\n" + c.header + "K:C\nc3/2|\n"
+		d := NewDecoder(*bufio.NewReader(strings.NewReader(in)), false)
+		if err := d.Decode(); err != nil || len(d.Tunes) != 1 {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		tune := d.Tunes[0]
+		if got := tune.UnitNoteLength.String(); got != c.length {
+			t.Errorf("%q: got unit note length %s, want %s", in, got, c.length)
+		}
+		note := tune.Measures[0].NoteGroups[0].Units[0]
+		if got := note.GetAbsoluteDuration().String(); got != c.absolute || note.GetDuration().String() != "3/2" {
+			t.Errorf("%q: note of 3/2 units lasts %s, want %s", in, got, c.absolute)
+		}
+	}
+}
@@ -0,0 +1,322 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Key is the key of a K: field, like "G", "F#m", "Bb dorian", "HP" or "D exp ^c _b",
+//with the clef and transposition that may follow it.
+type Key struct {
+	//Tonic is the note letter of the key, from "A" to "G".
+	//It is empty for K:none, the highland pipes and a K: field that only changes the clef.
+	Tonic string `json:"tonic,omitempty"`
+	//Accidental is "#" or "b" for keys like F# or Bb.
+	Accidental string `json:"accidental,omitempty"`
+	//Mode is the full name of the mode: major, minor, ionian, dorian, phrygian,
+	//lydian, mixolydian, aeolian or locrian.
+	Mode string `json:"mode,omitempty"`
+	//None is set for K:none, which has no key signature at all.
+	None bool `json:"none,omitempty"`
+	//HighlandPipes is "HP" or "Hp" for bagpipe music, where F and C are played sharp.
+	//Only "Hp" shows these sharps in the key signature.
+	HighlandPipes string `json:"highlandPipes,omitempty"`
+	//Explicit is set by "exp": the key signature is made of the explicit accidentals only.
+	Explicit bool `json:"explicit,omitempty"`
+	//Accidentals are the accidentals written after the key, like "^c _b".
+	//They are added to the key signature, or replace it if the key is explicit.
+	Accidentals []KeyAccidental `json:"accidentals,omitempty"`
+	Staff
+	//Unknown are the words that are not known as a key or modifier, like "stafflines=4".
+	//They are kept to write them again.
+	Unknown []string `json:"unknown,omitempty"`
+}
+
+//Staff holds the clef and transposition of the music, set by the modifiers of K: and V: fields
+//like "clef=bass" or "transpose=-2".
+type Staff struct {
+	Clef string `json:"clef,omitempty"`
+	//Transpose is the number of semitones the music sounds higher than written.
+	Transpose int `json:"transpose,omitempty"`
+	//Octave is the number of octaves the music sounds higher than written.
+	Octave int `json:"octave,omitempty"`
+	//Middle is the pitch written on the middle line of the staff, like "B" or "d".
+	Middle string `json:"middle,omitempty"`
+	//transposes is set when Transpose or Octave is given, even if it is 0.
+	transposes bool
+}
+
+//KeyAccidental is an accidental in the key signature, applying to a note letter in all octaves.
+type KeyAccidental struct {
+	Step       string     `json:"step"`
+	Accidental Accidental `json:"accidental"`
+}
+
+//fifths of each tonic in a major key, negative for flats.
+var tonicFifths = map[byte]int{'C': 0, 'G': 1, 'D': 2, 'A': 3, 'E': 4, 'B': 5, 'F': -1}
+
+//modes by the first three letters of their name, which is all that ABC looks at.
+var modes = map[string]string{
+	"maj": "major",
+	"ion": "ionian",
+	"mix": "mixolydian",
+	"dor": "dorian",
+	"m":   "minor",
+	"min": "minor",
+	"aeo": "aeolian",
+	"phr": "phrygian",
+	"lyd": "lydian",
+	"loc": "locrian",
+}
+
+//modeFifths shifts the fifths of a major key to its other modes.
+var modeFifths = map[string]int{
+	"major":      0,
+	"ionian":     0,
+	"mixolydian": -1,
+	"dorian":     -2,
+	"minor":      -3,
+	"aeolian":    -3,
+	"phrygian":   -4,
+	"lydian":     1,
+	"locrian":    -5,
+}
+
+//clefs that may be given without "clef=".
+var clefNames = []string{"treble", "bass", "baritone", "tenor", "alto", "mezzosoprano", "soprano", "perc", "none"}
+
+//parseKey reads the text of a K: field.
+//key ::= [tonic, [accidental], [mode]] | "none" | "HP" | "Hp", {" ", modifier};
+//modifier ::= "exp" | accidental, letter | clef | "clef=", clef | keyTranspose | keyMiddle;
+//keyTranspose ::= ("transpose=" | "t=" | "octave="), integer;
+//keyMiddle ::= ("middle=" | "m="), pitch;
+func parseKey(text string) (Key, error) {
+	key := Key{}
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return key, nil
+	}
+
+	first := words[0]
+	switch {
+	case first == "none":
+		key.None = true
+		words = words[1:]
+	case first == "HP" || first == "Hp":
+		key.HighlandPipes = first
+		words = words[1:]
+	case first[0] >= 'A' && first[0] <= 'G':
+		key.Tonic = first[0:1]
+		first = first[1:]
+		if strings.HasPrefix(first, "#") || strings.HasPrefix(first, "b") {
+			key.Accidental = first[0:1]
+			first = first[1:]
+		}
+		if first != "" {
+			mode, ok := parseMode(first)
+			if !ok {
+				return key, errors.Errorf("unknown mode %q", first)
+			}
+			key.Mode = mode
+		}
+		words = words[1:]
+		if key.Mode == "" && len(words) > 0 {
+			if mode, ok := parseMode(words[0]); ok {
+				key.Mode = mode
+				words = words[1:]
+			}
+		}
+		if key.Mode == "" {
+			key.Mode = "major"
+		}
+	}
+
+	for _, word := range words {
+		if err := key.parseModifier(word); err != nil {
+			return key, err
+		}
+	}
+	return key, nil
+}
+
+//parseMode returns the full name of a mode like "m", "Dor" or "mixolydian".
+func parseMode(word string) (string, bool) {
+	word = strings.ToLower(word)
+	if len(word) > 3 {
+		word = word[:3]
+	}
+	mode, ok := modes[word]
+	return mode, ok
+}
+
+//parseModifier reads a single word following the key.
+//Unknown modifiers, like "stafflines=4", are kept in Unknown.
+func (k *Key) parseModifier(word string) error {
+	if word == "exp" {
+		k.Explicit = true
+		return nil
+	}
+	if word[0] == '^' || word[0] == '_' || word[0] == '=' {
+		letter := strings.IndexAny(word, "ABCDEFGabcdefg")
+		if letter == -1 || letter != len(word)-1 {
+			return errors.Errorf("key accidental %q not properly formatted", word)
+		}
+		accidental, err := parseAccidental(word[:letter])
+		if err != nil {
+			return err
+		}
+		k.Accidentals = append(k.Accidentals, KeyAccidental{
+			Step:       strings.ToUpper(word[letter:]),
+			Accidental: *accidental,
+		})
+		return nil
+	}
+
+	known, err := k.Staff.parseModifier(word)
+	if !known {
+		k.Unknown = append(k.Unknown, word)
+	}
+	return err
+}
+
+//parseModifier reads a clef or transposition modifier, like "clef=bass", "bass" or "t=-2".
+//It returns false if the word is not one of these.
+func (s *Staff) parseModifier(word string) (bool, error) {
+	name, value := word, ""
+	if i := strings.IndexByte(word, '='); i != -1 {
+		name, value = word[:i], word[i+1:]
+	}
+	var err error
+	switch name {
+	case "clef":
+		s.Clef = value
+	case "transpose", "t":
+		s.Transpose, err = strconv.Atoi(value)
+		s.transposes = true
+	case "octave":
+		s.Octave, err = strconv.Atoi(value)
+		s.transposes = true
+	case "middle", "m":
+		s.Middle = value
+	default:
+		for _, clef := range clefNames {
+			if strings.HasPrefix(word, clef) {
+				s.Clef = word
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, errors.Wrapf(err, "modifier %q not properly formatted", word)
+}
+
+//semitones returns the number of semitones the music sounds higher than written.
+func (s *Staff) semitones() int {
+	return s.Transpose + 12*s.Octave
+}
+
+//HasTransposition reports whether the staff sets a transposition with transpose= or octave=.
+//A K: field without them keeps the previous one.
+func (s *Staff) HasTransposition() bool {
+	return s.transposes || s.Transpose != 0 || s.Octave != 0
+}
+
+//modifiers returns the clef and transposition as written after a K: or V: field.
+func (s *Staff) modifiers() []string {
+	var words []string
+	if s.Clef != "" {
+		words = append(words, "clef="+s.Clef)
+	}
+	if s.Transpose != 0 {
+		words = append(words, "transpose="+strconv.Itoa(s.Transpose))
+	}
+	if s.Octave != 0 {
+		words = append(words, "octave="+strconv.Itoa(s.Octave))
+	}
+	if s.Middle != "" {
+		words = append(words, "middle="+s.Middle)
+	}
+	return words
+}
+
+//HasSignature reports whether the key sets a key signature.
+//A K: field with only a clef or transposition keeps the previous one.
+func (k *Key) HasSignature() bool {
+	return k.Tonic != "" || k.None || k.HighlandPipes != "" || k.Explicit || len(k.Accidentals) > 0
+}
+
+//Signature returns the alteration in semitones of each note letter, like "F" and "C"
+//in D major. Note letters that are not altered are left out.
+func (k *Key) Signature() map[string]Fraction {
+	signature := map[string]Fraction{}
+	switch {
+	case k.Explicit || k.None:
+	case k.HighlandPipes != "":
+		signature["F"] = NewFraction(1, 1)
+		signature["C"] = NewFraction(1, 1)
+	case k.Tonic != "":
+		fifths := tonicFifths[k.Tonic[0]] + modeFifths[k.Mode]
+		if k.Accidental == "#" {
+			fifths += 7
+		} else if k.Accidental == "b" {
+			fifths -= 7
+		}
+		signature = fifthsSignature(fifths)
+	}
+	for _, a := range k.Accidentals {
+		if a.Accidental.Natural {
+			delete(signature, a.Step)
+		} else {
+			signature[a.Step] = a.Accidental.Semitones
+		}
+	}
+	return signature
+}
+
+//String returns the key as written in a K: field.
+func (k *Key) String() string {
+	var words []string
+	switch {
+	case k.None:
+		words = append(words, "none")
+	case k.HighlandPipes != "":
+		words = append(words, k.HighlandPipes)
+	case k.Tonic != "":
+		mode := ""
+		switch k.Mode {
+		case "", "major":
+		case "minor":
+			mode = "m"
+		default:
+			mode = k.Mode[:3]
+		}
+		words = append(words, k.Tonic+k.Accidental+mode)
+	}
+	if k.Explicit {
+		words = append(words, "exp")
+	}
+	for _, a := range k.Accidentals {
+		words = append(words, a.Accidental.String()+strings.ToLower(a.Step))
+	}
+	words = append(words, k.modifiers()...)
+	words = append(words, k.Unknown...)
+	return strings.Join(words, " ")
+}
+
+//fifthsSignature returns the signature of a key with the given number of sharps, or flats if negative.
+func fifthsSignature(fifths int) map[string]Fraction {
+	counts := map[string]int64{}
+	for i := 0; i < fifths; i++ {
+		counts["FCGDAEB"[i%7:i%7+1]]++
+	}
+	for i := 0; i < -fifths; i++ {
+		counts["BEADGCF"[i%7:i%7+1]]--
+	}
+	signature := map[string]Fraction{}
+	for step, count := range counts {
+		signature[step] = NewFraction(count, 1)
+	}
+	return signature
+}
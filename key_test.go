@@ -0,0 +1,31 @@
+package abc
+
+import "testing"
+
+func TestParseKey(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		written string
+		unknown int
+	}{
+		{"G", "G", 0},
+		{"F#m", "F#m", 0},
+		{"Bb dorian", "Bbdor", 0},
+		{"D exp ^c _b", "D exp ^c _b", 0},
+		{"HP", "HP", 0},
+		{"C bass t=-2", "C clef=bass transpose=-2", 0},
+		{"Dlyd stafflines=4", "Dlyd stafflines=4", 1},
+		{"Hx", "Hx", 1},
+	} {
+		key, err := parseKey(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+		}
+		if got := key.String(); got != c.written {
+			t.Errorf("%q: written as %q, want %q", c.in, got, c.written)
+		}
+		if len(key.Unknown) != c.unknown {
+			t.Errorf("%q: got unknown words %v", c.in, key.Unknown)
+		}
+	}
+}
@@ -1,8 +1,8 @@
 package abc
 
 import (
-	"bufio"
 	"bytes"
+	"io"
 	"regexp"
 )
 
@@ -11,16 +11,27 @@ import (
 //it supports the act of reading the music body.
 type byteToken struct {
 	token []byte
+	//next is the byte after the token, which tells an inline field like "[K:" from a chord like "[CE".
+	next byte
 }
 
-func peekLexToken(r *bufio.Reader) (byteToken, error) {
+//peekLexToken peeks the next two bytes, and the byte after them.
+//At the end of the file, a single remaining byte is padded with a zero byte.
+func peekLexToken(r *positionReader) (byteToken, error) {
 	var t byteToken
 	var err error
 	t.token = make([]byte, 2, 2)
-	t.token, err = r.Peek(2)
+	peeked, err := r.Peek(3)
+	if err == io.EOF && len(peeked) > 0 {
+		err = nil
+	}
 	if err != nil {
 		return t, err
 	}
+	copy(t.token, peeked)
+	if len(peeked) == 3 {
+		t.next = peeked[2]
+	}
 	return t, nil
 }
 
@@ -33,12 +44,51 @@ func (t *byteToken) isBrokenRhythm() bool {
 }
 
 func (t *byteToken) isNewline() bool {
-	return t.token[0] == '\n'
+	return t.token[0] == '\n' || bytes.Compare(t.token, []byte("\r\n")) == 0
 }
 
 func (t *byteToken) isElement() bool {
 	return t.isNote() || t.isAnnotation() || t.isBarline() ||
-		t.isSpace() || t.isInline() || t.isRepeat() || t.isChord() || t.isBrokenRhythm()
+		t.isSpace() || t.isInline() || t.isEnding() || t.isChord() || t.isBrokenRhythm() ||
+		t.isTie() || t.isSlurStart() || t.isSlurEnd() || t.isTuplet() || t.isGraceNotes() || t.isDecoration()
+}
+
+func (t *byteToken) isDecoration() bool {
+	return t.token[0] == '!'
+}
+
+//isSymbol checks for a single character that stands for a decoration, like "T" for a trill.
+//A '.' is a staccato, unless it starts a dotted tie ".-", a dotted slur ".(" or a dotted barline ".|".
+func (t *byteToken) isSymbol(symbols map[byte]string) bool {
+	if _, ok := symbols[t.token[0]]; !ok {
+		return false
+	}
+	return !t.isTie() && !t.isSlurStart() && !t.isBarline()
+}
+
+func (t *byteToken) isGraceNotes() bool {
+	return t.token[0] == '{'
+}
+
+//isTuplet checks for the start of a tuplet, like "(3".
+func (t *byteToken) isTuplet() bool {
+	re := regexp.MustCompile(`[0-9]`)
+	return t.token[0] == '(' && re.Match(t.token[1:])
+}
+
+//isTie checks for a tie '-' or a dotted tie '.-'.
+func (t *byteToken) isTie() bool {
+	return t.token[0] == '-' || bytes.Compare(t.token, []byte(".-")) == 0
+}
+
+//isSlurStart checks for a slur '(' or a dotted slur '.(', but not the start of a tuplet like "(3".
+func (t *byteToken) isSlurStart() bool {
+	re := regexp.MustCompile(`[0-9]`)
+	return (t.token[0] == '(' && !re.Match(t.token[1:])) || bytes.Compare(t.token, []byte(".(")) == 0
+}
+
+func (t *byteToken) isSlurEnd() bool {
+	return t.token[0] == ')'
 }
 
 func (t *byteToken) isNote() bool {
@@ -54,8 +104,8 @@ func (t *byteToken) isAnnotation() bool {
 }
 
 func (t *byteToken) isChord() bool {
-	re := regexp.MustCompile(`[a-gA-G]`)
-	return re.Match(t.token) && t.token[0] == '['
+	re := regexp.MustCompile(`[a-gA-G^_=]`)
+	return t.token[0] == '[' && re.Match(t.token[1:]) && !t.isInline()
 }
 
 func (t *byteToken) isBarline() bool {
@@ -66,28 +116,30 @@ func (t *byteToken) isBarline() bool {
 	ret = ret || bytes.Compare(t.token, []byte("|]")) == 0
 	ret = ret || bytes.Compare(t.token, []byte(":|")) == 0
 	ret = ret || bytes.Compare(t.token, []byte("|:")) == 0
+	ret = ret || bytes.Compare(t.token, []byte("::")) == 0
+	ret = ret || bytes.Compare(t.token, []byte(".|")) == 0
 
 	return ret
 
 }
 
 func (t *byteToken) isInline() bool {
-	return t.token[0] == '[' && t.token[1] != '|'
+	re := regexp.MustCompile(`[A-Za-z]`)
+	return t.token[0] == '[' && re.Match(t.token[1:]) && t.next == ':'
 }
 
-func (t *byteToken) isRepeat() bool {
-	if t.token[0] == '[' {
-		return t.token[1] == '1' || t.token[1] == '2'
-	}
-	return false
+//isEnding checks for the start of a variant ending like "[1" or "[2".
+//An ending right after a barline, like "|2", is read with the barline.
+func (t *byteToken) isEnding() bool {
+	return t.token[0] == '[' && t.token[1] >= '0' && t.token[1] <= '9'
 }
 
 func (t *byteToken) isRest() bool {
-	return t.token[0] == 'z'
+	return t.token[0] == 'z' || t.token[0] == 'x' || t.token[0] == 'Z' || t.token[0] == 'X'
 }
 
 func (t *byteToken) isPitch() bool {
-	re := regexp.MustCompile(`[',a-gA-G]`)
+	re := regexp.MustCompile(`[',a-gA-G^_=]`)
 	return re.Match(t.token[:1])
 }
 
@@ -97,6 +149,6 @@ func (t *byteToken) isDigit() bool {
 }
 
 func (t *byteToken) isTuneBodyInfoField() bool {
-	re := regexp.MustCompile(`[A-Zw]:`)
+	re := regexp.MustCompile(`[A-Zmw+]:`)
 	return re.Match(t.token)
 }
@@ -0,0 +1,214 @@
+package abc
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Macro is a short way of writing music, defined in an m: field like "m: ~G3 = G{A}G{F}G".
+//A transposing macro has an 'n' in its target, which stands for any note, like "m: ~n2 = (3o/n/m/ n".
+//In its expansion, the letters h to z are the notes that many steps above or below that note.
+type Macro struct {
+	Target    string `json:"target"`
+	Expansion string `json:"expansion"`
+}
+
+//MacroUse is music in a measure that was written with a macro, which is kept to write it the same way again.
+//The music starts at unit Start of notegroup Group and ends before unit End of notegroup EndGroup.
+type MacroUse struct {
+	//Text is the macro as written, like "~G3".
+	Text     string `json:"text"`
+	Group    int    `json:"group"`
+	Start    int    `json:"start"`
+	EndGroup int    `json:"endGroup"`
+	End      int    `json:"end"`
+}
+
+//contains checks whether unit k of notegroup j, which comes after the start of the macro, is part of its music.
+func (u *MacroUse) contains(j, k int) bool {
+	return j < u.EndGroup || (j == u.EndGroup && k < u.End)
+}
+
+//maxOctaveMarks is the number of octave marks a note may have to match a transposing macro.
+const maxOctaveMarks = 16
+
+//parseMacro reads the text of an m: field.
+//The target and expansion are separated by " = ", or by the first '=' without spaces around it.
+//macro ::= target, '=', expansion;
+func parseMacro(text string) (Macro, error) {
+	separator := " = "
+	equals := strings.Index(text, separator)
+	if equals == -1 {
+		separator = "="
+		equals = strings.Index(text, separator)
+	}
+	if equals == -1 {
+		return Macro{}, errors.New("macro has no '='")
+	}
+	macro := Macro{Target: strings.TrimSpace(text[:equals]), Expansion: strings.TrimSpace(text[equals+len(separator):])}
+	if macro.Target == "" || strings.ContainsAny(macro.Target, " \t") {
+		return macro, errors.Errorf("macro target %q not properly formatted", macro.Target)
+	}
+	if macro.Expansion == "" {
+		return macro, errors.New("macro has no expansion")
+	}
+	return macro, nil
+}
+
+//defineMacro adds a macro to macros, replacing an earlier macro with the same target.
+func defineMacro(macros []Macro, macro Macro) []Macro {
+	for i := range macros {
+		if macros[i].Target == macro.Target {
+			macros[i] = macro
+			return macros
+		}
+	}
+	return append(macros, macro)
+}
+
+//isTransposing checks whether the target of the macro has an 'n', which stands for any note.
+func (m *Macro) isTransposing() bool {
+	return strings.IndexByte(m.Target, 'n') != -1
+}
+
+//match checks whether text starts with the target of the macro.
+//It returns the music the macro stands for and the number of bytes of text it replaces.
+func (m *Macro) match(text string) (string, int, bool) {
+	if !m.isTransposing() {
+		return m.Expansion, len(m.Target), strings.HasPrefix(text, m.Target)
+	}
+	n := strings.IndexByte(m.Target, 'n')
+	if !strings.HasPrefix(text, m.Target[:n]) || len(text) <= n || strings.IndexByte("abcdefgABCDEFG", text[n]) == -1 {
+		return "", 0, false
+	}
+	end := n + 1
+	for end < len(text) && (text[end] == '\'' || text[end] == ',') {
+		end++
+	}
+	if !strings.HasPrefix(text[end:], m.Target[n+1:]) {
+		return "", 0, false
+	}
+	return m.transpose(text[n:end]), end + len(m.Target) - n - 1, true
+}
+
+//transpose returns the expansion of a transposing macro for a note, like "G,".
+//Decorations and quoted text in the expansion are not transposed.
+func (m *Macro) transpose(note string) string {
+	step, octave := parsePitch(note)
+	index := strings.Index(steps, step)
+	var sb strings.Builder
+	var quote byte
+	for i := 0; i < len(m.Expansion); i++ {
+		c := m.Expansion[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			sb.WriteByte(c)
+		case c == '!' || c == '"':
+			quote = c
+			sb.WriteByte(c)
+		case c >= 'h' && c <= 'z':
+			transposed, o := index+int(c)-'n', octave
+			for transposed < 0 {
+				transposed += len(steps)
+				o--
+			}
+			o += transposed / len(steps)
+			sb.WriteString(formatPitch(steps[transposed%len(steps):transposed%len(steps)+1], o))
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return sb.String()
+}
+
+//steps are the note letters in the order of the scale.
+const steps = "CDEFGAB"
+
+//String returns the macro as written in an m: field.
+func (m Macro) String() string {
+	return m.Target + " = " + m.Expansion
+}
+
+//readMacroField reads the text of an m: field and defines its macro.
+//In the file header, it holds for every tune in the file.
+func (d *Decoder) readMacroField(line string) error {
+	macro, err := parseMacro(line)
+	if err != nil {
+		return err
+	}
+	if d.inFileHeader {
+		d.Macro = defineMacro(d.Macro, macro)
+	} else {
+		d.tune.Macro = defineMacro(d.tune.Macro, macro)
+	}
+	return nil
+}
+
+//readMacro reads the music a macro stands for, if the tune body continues with the target of a macro.
+//It returns false if there is no macro. The music is kept with the macro as written, if it is in a single measure.
+func (d *Decoder) readMacro() (bool, error) {
+	for i := range d.tune.Macro {
+		macro := &d.tune.Macro[i]
+		text, _ := d.r.Peek(len(macro.Target) + maxOctaveMarks)
+		expansion, length, ok := macro.match(string(text))
+		if !ok {
+			continue
+		}
+		start := d.r.pos
+		written := string(text[:length])
+		for j := 0; j < length; j++ {
+			d.r.ReadByte()
+		}
+
+		measure := d.currentMeasure()
+		use := MacroUse{Text: written, Group: len(measure.NoteGroups) - 1}
+		use.Start = len(measure.NoteGroups[use.Group].Units)
+		last := measure.lastUnit()
+		pending := !reflect.DeepEqual(d.attached, Attached{})
+
+		//the expansion is read as if it was written in place of the macro.
+		reader := d.r
+		d.r = newPositionReader(bufio.NewReader(strings.NewReader(expansion)))
+		d.r.pos = start
+		err := d.readExpansion()
+		d.r = reader
+		if err != nil {
+			return true, err
+		}
+
+		//the music is only kept with the macro if all of it is in the units of the macro,
+		//so that nothing is written twice. Otherwise it is written as it was expanded.
+		kept := d.currentMeasure() == measure && measure.lastUnit() != last
+		kept = kept && !pending && reflect.DeepEqual(d.attached, Attached{}) && d.brokenRhythm == nil
+		if kept {
+			use.EndGroup = len(measure.NoteGroups) - 1
+			use.End = len(measure.NoteGroups[use.EndGroup].Units)
+			measure.Macros = append(measure.Macros, use)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+//readExpansion reads the elements of the music a macro stands for. Macros are not expanded in it.
+func (d *Decoder) readExpansion() error {
+	for {
+		b, err := peekLexToken(d.r)
+		if err != nil {
+			return nil
+		}
+		if !b.isElement() && !b.isSymbol(d.symbols) {
+			return d.fail(d.r.pos, CodeSyntax, errors.Errorf("unexpected character %q in macro", d.r.peekRune()))
+		}
+		err = d.readElement()
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -1,100 +1,294 @@
 package abc
 
+import "encoding/json"
+
 //Measure is just one measure of the song.
+//A change of meter in the measure is kept in Meter, and in MeterTop and MeterBottom where
+//the meter has a top and bottom.
+//Barline is the barline that starts the measure as written, like "|", ":|:", ".|" or "[|]" for an invisible one.
+//Ending holds the numbers of the repeats that play the variant ending starting with the measure.
+//EndingNotation is the ending as written, like "[1,3", "[2-4" or "2" right after a barline like ":|2".
+//Decorations are the decorations on the barline that ends the measure, like a fermata or "!D.C.!".
+//ChordSymbol and Annotations are the text written in front of that barline, like "Fine".
+//At the end of the tune, they are what is written after the last note.
+//Macros are the music in the measure that was written with a macro.
 type Measure struct {
-	MeterTop     uint64 `json:"meterTop,omitempty"`
-	MeterBottom  uint64 `json:"meterBottom,omitempty"`
-	RepeatStart  bool   `json:"repeatStart,omitempty"`
-	RepeatEnd    bool   `json:"repeatEnd,omitempty"`
-	ThickStart   bool   `json:"startThick,omitempty"`
-	ThickEnd     bool   `json:"endThick,omitempty"`
-	BarlineStart bool   `json:"barlineStart,omitempty"`
-	NoteGroups   []NoteGroup
+	Meter          *Meter       `json:"meter,omitempty"`
+	MeterTop       uint64       `json:"meterTop,omitempty"`
+	MeterBottom    uint64       `json:"meterBottom,omitempty"`
+	RepeatStart    bool         `json:"repeatStart,omitempty"`
+	RepeatEnd      bool         `json:"repeatEnd,omitempty"`
+	ThickStart     bool         `json:"startThick,omitempty"`
+	ThickEnd       bool         `json:"endThick,omitempty"`
+	BarlineStart   bool         `json:"barlineStart,omitempty"`
+	Barline        string       `json:"barline,omitempty"`
+	Ending         []int        `json:"ending,omitempty"`
+	EndingNotation string       `json:"endingNotation,omitempty"`
+	Decorations    []Decoration `json:"decorations,omitempty"`
+	ChordSymbol    *ChordSymbol `json:"chordSymbol,omitempty"`
+	Annotations    []Annotation `json:"annotations,omitempty"`
+	NoteGroups     []NoteGroup
+	Macros         []MacroUse `json:"macros,omitempty"`
+}
+
+//Duration returns the sum of the durations of all units in the measure,
+//as a fraction of a whole note. A full measure in 3/4 has a duration of 3/4.
+func (m *Measure) Duration() Fraction {
+	duration := NewFraction(0, 1)
+	for _, ng := range m.NoteGroups {
+		for _, unit := range ng.Units {
+			duration = duration.Add(unit.GetAbsoluteDuration())
+		}
+	}
+	return duration
+}
+
+//lastUnit returns the last unit in the measure that is not a Field, or nil if it has none.
+func (m *Measure) lastUnit() Unit {
+	for i := len(m.NoteGroups) - 1; i >= 0; i-- {
+		if units := m.NoteGroups[i].Units; len(units) > 0 {
+			for j := len(units) - 1; j >= 0; j-- {
+				if _, isField := units[j].(*Field); !isField {
+					return units[j]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+//attachBarline moves the chord symbol, annotations and decorations in a, which are written
+//in front of the barline that ends the measure, to the measure.
+func (m *Measure) attachBarline(a *Attached) {
+	m.ChordSymbol, m.Annotations, m.Decorations = a.ChordSymbol, a.Annotations, a.Decorations
+	a.ChordSymbol, a.Annotations, a.Decorations = nil, nil, nil
 }
 
 //NoteGroup denotes one group of notes that should be paired using a beam.
+//LineBreak is set when the line of music ends after this group.
+//Tuplets are the tuplets that start in this group, their notes may continue in the next groups.
 type NoteGroup struct {
-	Units []Unit
+	Units     []Unit
+	LineBreak bool     `json:"lineBreak,omitempty"`
+	Tuplets   []Tuplet `json:"tuplets,omitempty"`
 }
 
 func (ng *NoteGroup) addUnit(unit Unit) {
 	ng.Units = append(ng.Units, unit)
 }
 
-//Unit is an interface that is implemented by either chord, note or rest
+//Unit is an interface that is implemented by either chord, note or rest,
+//or a field in the tune body, which takes no time.
+//The duration is in unit note lengths (L:), the absolute duration is a fraction of a whole note.
 type Unit interface {
 	GetValue() string
-	GetDuration() float64
-	SetDuration(float64)
+	GetDuration() Fraction
+	SetDuration(Fraction)
+	GetAbsoluteDuration() Fraction
+}
+
+//Attached holds what is written around a note, rest or chord and belongs to it,
+//like grace notes, a chord symbol, annotations, decorations and slurs.
+//SlurStarts are the slurs starting at the unit, "(" or ".(" for a dotted slur.
+//SlurEnd is the number of slurs ending at the unit.
+type Attached struct {
+	GraceNotes  *GraceNotes  `json:"graceNotes,omitempty"`
+	ChordSymbol *ChordSymbol `json:"chordSymbol,omitempty"`
+	Annotations []Annotation `json:"annotations,omitempty"`
+	Decorations []Decoration `json:"decorations,omitempty"`
+	SlurStarts  []string     `json:"slurStarts,omitempty"`
+	SlurEnd     int          `json:"slurEnd,omitempty"`
+}
+
+//attacher is implemented by the units that can have things attached to them.
+type attacher interface {
+	attached() *Attached
+}
+
+//attached returns what is attached to a note, rest or chord.
+func (a *Attached) attached() *Attached {
+	return a
 }
 
 //Note holds the information of a single note in music.
 //This could also be a rest, in which case the value is Z or x
 //The duration is the duration in terms of spaces it occupies in the measure.
 //or, how many units!
-//in case of a 1/4 measure, a duration of 0.5 will be an eigth note.
+//in case of a 1/4 measure, a duration of 1/2 will be an eigth note.
 //A duration of 2 will be a half note.
 //A duration of 3 will be a three-quarter note etc.
-//this should scale to 1/128th notes. Does it? Float imprecisions...
+//Durations are exact fractions, so they scale to 1/128th notes, triplets and broken rhythms.
+//The Value holds the note letter and octave as written, an accidental in front of it is kept in Accidental.
+//Step and Octave hold the same pitch in scientific pitch notation: "C" and 4 for middle C.
+//Alteration is the number of semitones the note sounds higher or lower, following
+//from its accidental, earlier accidentals in the same bar or the key signature.
+//Transpose is the number of semitones the note sounds higher than written,
+//from the transpose= and octave= modifiers of the key.
+//TieStart is set when the note is tied to the next note of the same pitch, which has TieEnd set.
+//Playing them, the tied notes are a single note of their combined duration.
 type Note struct {
-	Value    string  `json:"value"`
-	Duration float64 `json:"duration"`
+	Attached
+	Value      string      `json:"value"`
+	Step       string      `json:"step"`
+	Octave     int         `json:"octave"`
+	Accidental *Accidental `json:"accidental,omitempty"`
+	Alteration Fraction    `json:"alteration"`
+	Transpose  int         `json:"transpose,omitempty"`
+	TieStart   bool        `json:"tieStart,omitempty"`
+	TieDotted  bool        `json:"tieDotted,omitempty"`
+	TieEnd     bool        `json:"tieEnd,omitempty"`
+	Duration   Fraction    `json:"duration"`
+	//UnitNoteLength is the unit note length (L:) the duration is expressed in.
+	UnitNoteLength Fraction `json:"unitNoteLength"`
 }
 
 //Rest is a simple way to denote the rest in a measure.
+//An invisible rest takes time like any other rest, but it is not printed.
+//A multi-measure rest lasts for a number of full measures, which its Duration is the length of.
 type Rest struct {
-	Duration float64 `json:"duration"`
+	Attached
+	Invisible      bool     `json:"invisible,omitempty"`
+	Measures       int      `json:"measures,omitempty"`
+	Duration       Fraction `json:"duration"`
+	UnitNoteLength Fraction `json:"unitNoteLength"`
 }
 
 //Chord holds the values of a chord.
+//Value holds the notes as written between the brackets, without their accidentals.
+//The Duration is the time the chord takes, which is that of its first note.
 type Chord struct {
-	notes    []Note
-	Value    string  `json:"value"`
-	Duration float64 `json:"duration"`
+	Attached
+	notes          []Note
+	Value          string   `json:"value"`
+	Duration       Fraction `json:"duration"`
+	UnitNoteLength Fraction `json:"unitNoteLength"`
+}
+
+//Field is an information field in the tune body, written inline like [L:1/16]
+//or on a line of its own if Line is set. It takes no time in the measure,
+//but changes how the music after it is read.
+//A change of key or tempo is also kept in Key or Tempo.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	Line  bool   `json:"line,omitempty"`
+	Key   *Key   `json:"key,omitempty"`
+	Tempo *Tempo `json:"tempo,omitempty"`
+}
+
+//NewChord returns a chord of the notes, which lasts as long as its first note.
+func NewChord(notes ...Note) *Chord {
+	chord := &Chord{notes: append([]Note(nil), notes...)}
+	for _, note := range notes {
+		chord.Value += note.Value
+	}
+	if len(notes) > 0 {
+		chord.Duration, chord.UnitNoteLength = notes[0].Duration, notes[0].UnitNoteLength
+	}
+	return chord
 }
 
-//GetValue returns a string with a comma separated list of values
+//GetValue returns the notes of the chord as written.
 func (c *Chord) GetValue() string {
 	return c.Value
 }
 
+//Notes returns the notes of the chord, with their own durations.
+func (c *Chord) Notes() []Note {
+	return c.notes
+}
+
 //SetDuration is used for when '<' or '>' is encountered.
-func (c *Chord) SetDuration(f float64) {
+//The durations of the notes of the chord are scaled along.
+func (c *Chord) SetDuration(f Fraction) {
+	scale := f.Div(c.Duration)
+	for i := range c.notes {
+		c.notes[i].Duration = c.notes[i].Duration.Mul(scale)
+	}
 	c.Duration = f
 }
 
-//GetDuration returns the duration of the chord; each chord can only have one duration!
-//So, a chord consisting of 3 notes can not have different durations for the notes.
-func (c *Chord) GetDuration() float64 {
+//GetDuration returns the duration of the chord, which is the duration of its first note.
+func (c *Chord) GetDuration() Fraction {
 	return c.Duration
 }
 
+//MarshalJSON includes the notes of the chord.
+func (c *Chord) MarshalJSON() ([]byte, error) {
+	type chord Chord
+	return json.Marshal(struct {
+		*chord
+		Notes []Note `json:"notes"`
+	}{(*chord)(c), c.notes})
+}
+
+//GetAbsoluteDuration returns the duration of the chord as a fraction of a whole note.
+func (c *Chord) GetAbsoluteDuration() Fraction {
+	return c.Duration.Mul(c.UnitNoteLength)
+}
+
 //GetValue returns the note value
 func (n *Note) GetValue() string {
 	return n.Value
 }
 
 //SetDuration is used for when '<' or '>' is encountered.
-func (n *Note) SetDuration(f float64) {
+func (n *Note) SetDuration(f Fraction) {
 	n.Duration = f
 }
 
 //GetDuration returns the duration of the note
-func (n *Note) GetDuration() float64 {
+func (n *Note) GetDuration() Fraction {
 	return n.Duration
 }
 
+//GetAbsoluteDuration returns the duration of the note as a fraction of a whole note.
+func (n *Note) GetAbsoluteDuration() Fraction {
+	return n.Duration.Mul(n.UnitNoteLength)
+}
+
 //GetValue returns the note value
 func (r *Rest) GetValue() string {
+	switch {
+	case r.Measures > 0 && r.Invisible:
+		return "X"
+	case r.Measures > 0:
+		return "Z"
+	case r.Invisible:
+		return "x"
+	}
 	return "z"
 }
 
 //GetDuration returns the duration of the note
-func (r *Rest) GetDuration() float64 {
+func (r *Rest) GetDuration() Fraction {
 	return r.Duration
 }
 
 //SetDuration is used for when '<' or '>' is encountered.
-func (r *Rest) SetDuration(f float64) {
+func (r *Rest) SetDuration(f Fraction) {
 	r.Duration = f
 }
+
+//GetAbsoluteDuration returns the duration of the rest as a fraction of a whole note.
+func (r *Rest) GetAbsoluteDuration() Fraction {
+	return r.Duration.Mul(r.UnitNoteLength)
+}
+
+//GetValue returns the field as written inline, like "[L:1/16]".
+func (f *Field) GetValue() string {
+	return "[" + f.Name + ":" + f.Value + "]"
+}
+
+//GetDuration returns zero, as a field takes no time.
+func (f *Field) GetDuration() Fraction {
+	return NewFraction(0, 1)
+}
+
+//SetDuration does nothing, as a field takes no time.
+func (f *Field) SetDuration(Fraction) {}
+
+//GetAbsoluteDuration returns zero, as a field takes no time.
+func (f *Field) GetAbsoluteDuration() Fraction {
+	return NewFraction(0, 1)
+}
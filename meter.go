@@ -0,0 +1,92 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Meter is the meter of an M: field, like "6/8", "C", "C|", "none" or "2+3+2/8".
+type Meter struct {
+	//Symbol is "C" for common time and "C|" for cut time, which are 4/4 and 2/2.
+	Symbol string `json:"symbol,omitempty"`
+	//Free is set for M:none, music without a meter.
+	Free bool `json:"free,omitempty"`
+	//Groups are the beats the top of the meter is made of, like 2, 3 and 2 for 2+3+2/8.
+	//A simple meter like 6/8 has a single group.
+	Groups []uint64 `json:"groups,omitempty"`
+	Bottom uint64   `json:"bottom,omitempty"`
+}
+
+//parseMeter reads the text of an M: field.
+//meter ::= "C" | "C|" | "none" | (meterTop | "(", meterTop, ")"), "/", DIGIT+;
+//meterTop ::= DIGIT+, {"+", DIGIT+};
+func parseMeter(text string) (Meter, error) {
+	text = strings.Join(strings.Fields(text), "")
+	switch text {
+	case "C":
+		return Meter{Symbol: "C", Groups: []uint64{4}, Bottom: 4}, nil
+	case "C|":
+		return Meter{Symbol: "C|", Groups: []uint64{2}, Bottom: 2}, nil
+	case "none", "":
+		return Meter{Free: true}, nil
+	}
+
+	divisor := strings.LastIndexByte(text, '/')
+	if divisor == -1 {
+		return Meter{}, errors.Errorf("meter %q has no '/'", text)
+	}
+	meter := Meter{}
+	top := strings.TrimSuffix(strings.TrimPrefix(text[:divisor], "("), ")")
+	for _, group := range strings.Split(top, "+") {
+		beats, err := strconv.ParseUint(group, 10, 64)
+		if err != nil {
+			return Meter{}, err
+		}
+		meter.Groups = append(meter.Groups, beats)
+	}
+	bottom, err := strconv.ParseUint(text[divisor+1:], 10, 64)
+	if err != nil {
+		return Meter{}, err
+	}
+	if bottom == 0 {
+		return Meter{}, errors.New("meter has a bottom of 0")
+	}
+	meter.Bottom = bottom
+	return meter, nil
+}
+
+//Top returns the top of the meter, which is the sum of its groups.
+//It is 0 for free meter.
+func (m *Meter) Top() uint64 {
+	top := uint64(0)
+	for _, beats := range m.Groups {
+		top += beats
+	}
+	return top
+}
+
+//Length returns the length of a full measure as a fraction of a whole note,
+//or 0 for free meter.
+func (m *Meter) Length() Fraction {
+	if m.Free || m.Bottom == 0 {
+		return NewFraction(0, 1)
+	}
+	return NewFraction(int64(m.Top()), int64(m.Bottom))
+}
+
+//String returns the meter as written in an M: field.
+func (m *Meter) String() string {
+	switch {
+	case m.Symbol != "":
+		return m.Symbol
+	case m.Free || m.Bottom == 0:
+		return "none"
+	}
+	groups := make([]string, len(m.Groups))
+	for i, beats := range m.Groups {
+		groups[i] = strconv.FormatUint(beats, 10)
+	}
+	return strings.Join(groups, "+") + "/" + strconv.FormatUint(m.Bottom, 10)
+}
@@ -0,0 +1,42 @@
+package abc
+
+import "testing"
+
+func TestParseMeter(t *testing.T) {
+	for _, c := range []struct {
+		in      string
+		top     uint64
+		bottom  uint64
+		length  string
+		written string
+	}{
+		{"6/8", 6, 8, "3/4", "6/8"},
+		{"C", 4, 4, "1", "C"},
+		{"C|", 2, 2, "1", "C|"},
+		{"none", 0, 0, "0", "none"},
+		{"", 0, 0, "0", "none"},
+		{"2+3+2/8", 7, 8, "7/8", "2+3+2/8"},
+		{"(2+3)/8", 5, 8, "5/8", "2+3/8"},
+		{"3 / 4", 3, 4, "3/4", "3/4"},
+	} {
+		meter, err := parseMeter(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		if meter.Top() != c.top || meter.Bottom != c.bottom {
+			t.Errorf("%q: got %d/%d, want %d/%d", c.in, meter.Top(), meter.Bottom, c.top, c.bottom)
+		}
+		if got := meter.Length().String(); got != c.length {
+			t.Errorf("%q: got length %s, want %s", c.in, got, c.length)
+		}
+		if got := meter.String(); got != c.written {
+			t.Errorf("%q: written as %q, want %q", c.in, got, c.written)
+		}
+	}
+	for _, in := range []string{"3", "x/4", "3/0", "3/x", "2++3/8"} {
+		if _, err := parseMeter(in); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
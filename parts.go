@@ -0,0 +1,196 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//PartOrder is the order the parts of a tune are played in, from the P: field in the tune header
+//like "A2B(CD)2", which plays A A B C D C D.
+type PartOrder []PartSequence
+
+//PartSequence is a single part like "A2", or a group of parts like "(CD)2", in a part order.
+type PartSequence struct {
+	//Part is the name of a single part, it is empty for a group.
+	Part  string         `json:"part,omitempty"`
+	Group []PartSequence `json:"group,omitempty"`
+	//Repeat is the number of times the part or group is played.
+	Repeat int `json:"repeat"`
+}
+
+//Section is a named part of the tune body, starting at a P: field in the body like "P:A".
+type Section struct {
+	Name     string    `json:"name"`
+	Measures []Measure `json:"measures"`
+}
+
+//maxPartRepeat is the number of times a part or group of parts may be repeated in a part order.
+const maxPartRepeat = 100
+
+//parsePartOrder reads the text of a P: field in the tune header.
+//Dots and spaces only make the order easier to read.
+//partOrder ::= {partSequence | "." | " "};
+//partSequence ::= ("A".."Z" | "(", partOrder, ")"), {DIGIT};
+func parsePartOrder(text string) (PartOrder, error) {
+	order, rest, err := readPartOrder(text)
+	if err == nil && rest != "" {
+		err = errors.Errorf("unexpected %q in part order", rest[0])
+	}
+	return order, err
+}
+
+//readPartOrder reads a part order up to the end of the text or a closing ')', which is returned with the rest of the text.
+func readPartOrder(text string) (PartOrder, string, error) {
+	order := PartOrder{}
+	for text != "" {
+		c := text[0]
+		sequence := PartSequence{Repeat: 1}
+		switch {
+		case c == '.' || c == ' ' || c == '\t':
+			text = text[1:]
+			continue
+		case c == ')':
+			return order, text, nil
+		case c >= 'A' && c <= 'Z':
+			sequence.Part = text[0:1]
+			text = text[1:]
+		case c == '(':
+			group, rest, err := readPartOrder(text[1:])
+			if err != nil {
+				return order, rest, err
+			}
+			if rest == "" {
+				return order, rest, errors.New("group of parts is not closed by ')'")
+			}
+			sequence.Group = group
+			text = rest[1:]
+		default:
+			return order, text, errors.Errorf("unexpected %q in part order", c)
+		}
+
+		digits := 0
+		for digits < len(text) && text[digits] >= '0' && text[digits] <= '9' {
+			digits++
+		}
+		if digits > 0 {
+			repeat, err := strconv.Atoi(text[:digits])
+			if err != nil {
+				return order, text, errors.Wrap(err, "repeat of part not properly formatted")
+			}
+			if repeat < 1 || repeat > maxPartRepeat {
+				return order, text, errors.Errorf("part is repeated %d times, which is not between 1 and %d", repeat, maxPartRepeat)
+			}
+			sequence.Repeat = repeat
+			text = text[digits:]
+		}
+		order = append(order, sequence)
+	}
+	return order, text, nil
+}
+
+//Names returns the names of the parts in the order they are played.
+func (o PartOrder) Names() []string {
+	var names []string
+	for _, sequence := range o {
+		for i := 0; i < sequence.Repeat; i++ {
+			if sequence.Part != "" {
+				names = append(names, sequence.Part)
+			} else {
+				names = append(names, PartOrder(sequence.Group).Names()...)
+			}
+		}
+	}
+	return names
+}
+
+//String returns the part order as written in a P: field.
+func (o PartOrder) String() string {
+	var sb strings.Builder
+	for _, sequence := range o {
+		if sequence.Part != "" {
+			sb.WriteString(sequence.Part)
+		} else {
+			sb.WriteString("(" + PartOrder(sequence.Group).String() + ")")
+		}
+		if sequence.Repeat != 1 {
+			sb.WriteString(strconv.Itoa(sequence.Repeat))
+		}
+	}
+	return sb.String()
+}
+
+//Expand returns the measures in the order of the parts. The measures are split into sections
+//at the P: fields in the body, a part that has no section is skipped.
+//Without a part order, the measures are returned as they are.
+func (o PartOrder) Expand(measures []Measure) []Measure {
+	if len(o) == 0 {
+		return measures
+	}
+	sections := namedSections(measures)
+	var expanded []Measure
+	for _, name := range o.Names() {
+		expanded = append(expanded, sections[name]...)
+	}
+	return expanded
+}
+
+//namedSections returns the measures of each section by name, sections with the same name are joined.
+func namedSections(measures []Measure) map[string][]Measure {
+	sections := map[string][]Measure{}
+	for _, section := range Sections(measures) {
+		sections[section.Name] = append(sections[section.Name], section.Measures...)
+	}
+	return sections
+}
+
+//ExpandParts returns the measures of the tune in the order of the parts in the P: field of the tune header.
+func (t *Tune) ExpandParts() []Measure {
+	return t.Parts.Expand(t.Measures)
+}
+
+//Sections splits measures into sections at the P: fields in the body.
+//Measures before the first P: field are in a section without a name.
+//A measure with music before the P: field is split in two at the field.
+func Sections(measures []Measure) []Section {
+	sections := []Section{{}}
+	for i := range measures {
+		m := &measures[i]
+		current := *m
+		current.NoteGroups = nil
+		music := false
+		for _, ng := range m.NoteGroups {
+			group := ng
+			group.Units = nil
+			current.NoteGroups = append(current.NoteGroups, group)
+			for _, u := range ng.Units {
+				if field, ok := u.(*Field); ok && field.Name == "P" {
+					if music {
+						//the music before the field stays in the previous section,
+						//the barline that ends the measure goes with the music after it.
+						rest := Measure{RepeatEnd: m.RepeatEnd, ThickEnd: m.ThickEnd, Decorations: m.Decorations, ChordSymbol: m.ChordSymbol, Annotations: m.Annotations}
+						current.RepeatEnd, current.ThickEnd = false, false
+						current.Decorations, current.ChordSymbol, current.Annotations, current.Macros = nil, nil, nil, nil
+						last := &current.NoteGroups[len(current.NoteGroups)-1]
+						last.LineBreak = false
+						sections[len(sections)-1].Measures = append(sections[len(sections)-1].Measures, current)
+						current = rest
+						current.NoteGroups = []NoteGroup{{LineBreak: ng.LineBreak}}
+						music = false
+					}
+					sections = append(sections, Section{Name: strings.TrimSpace(field.Value)})
+				}
+				current.NoteGroups[len(current.NoteGroups)-1].addUnit(u)
+				if u.GetDuration().Numerator != 0 {
+					music = true
+				}
+			}
+		}
+		sections[len(sections)-1].Measures = append(sections[len(sections)-1].Measures, current)
+	}
+	if len(sections[0].Measures) == 0 {
+		return sections[1:]
+	}
+	return sections
+}
@@ -0,0 +1,45 @@
+package abc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePartOrder(t *testing.T) {
+	for _, c := range []struct {
+		in    string
+		names string
+		err   bool
+	}{
+		{"ABA", "ABA", false},
+		{"A2B(CD)2", "AABCDCD", false},
+		{"A.B C", "ABC", false},
+		{"A0", "", true},
+		{"A101", "", true},
+		{"A99999999999999999999", "", true},
+		{"(AB", "", true},
+		{"A-B", "", true},
+	} {
+		order, err := parsePartOrder(c.in)
+		if (err != nil) != c.err {
+			t.Errorf("%q: got error %v", c.in, err)
+		} else if !c.err && strings.Join(order.Names(), "") != c.names {
+			t.Errorf("%q: got %v, want %s", c.in, order.Names(), c.names)
+		}
+	}
+}
+
+func TestExpandPartsKeepsMeasures(t *testing.T) {
+	tune, _ := decodeTune(t, "X:1\nT:t\nP:BA\nm:~n2=o/n/o/\nK:C\nP:A\n~c2 d\"Fine\"!fermata!|\nP:B\nE|\n", false)
+	for name, measures := range map[string][]Measure{"ExpandParts": tune.ExpandParts(), "Unroll": tune.Unroll()} {
+		if len(measures) != 3 {
+			t.Errorf("%s: got %d measures", name, len(measures))
+			continue
+		}
+		//part A is played last.
+		m := measures[2]
+		if len(m.Annotations) != 1 || m.Annotations[0].Text != "Fine" || len(m.Decorations) != 1 || len(m.Macros) != 1 {
+			t.Errorf("%s: got measure %+v", name, m)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package abc
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Accidental is an accidental written in front of a note: '^', '^^', '_', '__' or '='.
+//Microtonal accidentals such as '^/' (a quarter tone up) or '_3/2' have a
+//fractional number of semitones.
+type Accidental struct {
+	Natural bool `json:"natural,omitempty"`
+	//Semitones is the alteration of the note, 1 for a sharp and -2 for a double flat.
+	Semitones Fraction `json:"semitones"`
+}
+
+//String returns the accidental as written in ABC.
+func (a *Accidental) String() string {
+	if a.Natural {
+		return "="
+	}
+	sign := "^"
+	numerator := a.Semitones.Numerator
+	if numerator < 0 {
+		sign = "_"
+		numerator = -numerator
+	}
+	switch {
+	case a.Semitones.Denominator <= 1 && numerator <= 2:
+		return strings.Repeat(sign, int(numerator))
+	case a.Semitones.Denominator <= 1:
+		return sign + strconv.FormatInt(numerator, 10)
+	}
+	if numerator == 1 && a.Semitones.Denominator == 2 {
+		return sign + "/"
+	}
+	return sign + strconv.FormatInt(numerator, 10) + "/" + strconv.FormatInt(a.Semitones.Denominator, 10)
+}
+
+//readAccidental reads the accidental in front of a note, if there is any.
+func (d *Decoder) readAccidental() (*Accidental, error) {
+	written := []byte{}
+	for {
+		b, _ := d.r.Peek(len(written) + 1)
+		if len(b) <= len(written) {
+			break
+		}
+		c := b[len(written)]
+		isSymbol := c == '^' || c == '_' || c == '='
+		if !isSymbol && (len(written) == 0 || c != '/' && (c < '0' || c > '9')) {
+			break
+		}
+		written = append(written, c)
+	}
+	if len(written) == 0 {
+		return nil, nil
+	}
+	for range written {
+		d.r.ReadByte()
+	}
+	return parseAccidental(string(written))
+}
+
+//parseAccidental reads an accidental as written in front of a note.
+//accidental ::= '^' | '^^' | '_' | '__' | '=' | microtone;
+//microtone ::= ('^' | '_'), {DIGIT}, '/', {DIGIT};
+func parseAccidental(written string) (*Accidental, error) {
+	switch written {
+	case "=":
+		return &Accidental{Natural: true, Semitones: NewFraction(0, 1)}, nil
+	case "^^":
+		return &Accidental{Semitones: NewFraction(2, 1)}, nil
+	case "__":
+		return &Accidental{Semitones: NewFraction(-2, 1)}, nil
+	}
+	sign := int64(1)
+	switch written[0] {
+	case '^':
+	case '_':
+		sign = -1
+	default:
+		return nil, errors.Errorf("accidental %q not properly formatted", written)
+	}
+	written = written[1:]
+	if strings.ContainsAny(written, "^_=") {
+		return nil, errors.New("accidental mixes sharp and flat")
+	}
+
+	//microtonal accidental, with the same shorthand as a duration: '/' is 1/2.
+	numerator, denominator := int64(1), int64(1)
+	var err error
+	if i := strings.IndexByte(written, '/'); i != -1 {
+		denominator = 2
+		if written[i+1:] != "" {
+			denominator, err = strconv.ParseInt(written[i+1:], 10, 64)
+			if err != nil || denominator == 0 {
+				return nil, errors.New("could not read microtonal accidental")
+			}
+		}
+		written = written[:i]
+	}
+	if written != "" {
+		numerator, err = strconv.ParseInt(written, 10, 64)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not read microtonal accidental")
+		}
+	}
+	return &Accidental{Semitones: NewFraction(sign*numerator, denominator)}, nil
+}
+
+//semitones of each step above C.
+var stepSemitones = map[string]int{"C": 0, "D": 2, "E": 4, "F": 5, "G": 7, "A": 9, "B": 11}
+
+//MIDI returns the MIDI note number of the sounding pitch, 60 being middle C.
+//Microtonal alterations are rounded to the nearest semitone.
+func (n *Note) MIDI() int {
+	return 12*(n.Octave+1) + stepSemitones[n.Step] + int(math.Round(n.Alteration.Float64())) + n.Transpose
+}
+
+//sharpNames spell the sounding pitch of a note that is transposed by other than whole octaves.
+var sharpNames = []string{"C", "C#", "D", "D#", "E", "F", "F#", "G", "G#", "A", "A#", "B"}
+
+//PitchName returns the sounding pitch in scientific pitch notation, like "C4", "F#5" or "Bb3".
+//Microtonal alterations are rounded to the nearest semitone.
+//A note that is transposed by other than whole octaves is spelled with sharps.
+func (n *Note) PitchName() string {
+	if n.Transpose%12 != 0 {
+		midi := n.MIDI()
+		octave := midi/12 - 1
+		if midi < 0 {
+			octave = (midi-11)/12 - 1
+		}
+		return sharpNames[midi-12*(octave+1)] + strconv.Itoa(octave)
+	}
+	alteration := int(math.Round(n.Alteration.Float64()))
+	name := n.Step
+	if alteration > 0 {
+		name += strings.Repeat("#", alteration)
+	} else {
+		name += strings.Repeat("b", -alteration)
+	}
+	return name + strconv.Itoa(n.Octave+n.Transpose/12)
+}
+
+//parsePitch returns the step and the octave of a note as written, like "c'" or "B,,".
+//Octave 4 starts at "C", octave 5 at "c".
+func parsePitch(pitch string) (string, int) {
+	if pitch == "" {
+		return "", 0
+	}
+	step := strings.ToUpper(pitch[0:1])
+	octave := 4
+	if pitch[0] >= 'a' {
+		octave = 5
+	}
+	octave += strings.Count(pitch, "'") - strings.Count(pitch, ",")
+	return step, octave
+}
+
+//formatPitch returns the note letter and octave marks for a step and octave.
+func formatPitch(step string, octave int) string {
+	if octave >= 5 {
+		return strings.ToLower(step) + strings.Repeat("'", octave-5)
+	}
+	return step + strings.Repeat(",", 4-octave)
+}
+
+//alteration returns the semitones note n is raised or lowered by, following from
+//its own accidental, an earlier accidental on the same note in this bar or the key signature.
+func (d *Decoder) alteration(n *Note) Fraction {
+	barKey := n.Step + strconv.Itoa(n.Octave)
+	if n.Accidental != nil {
+		d.barAccidentals[barKey] = n.Accidental.Semitones
+		return n.Accidental.Semitones
+	}
+	if alteration, ok := d.barAccidentals[barKey]; ok {
+		return alteration
+	}
+	if alteration, ok := d.signature[n.Step]; ok {
+		return alteration
+	}
+	return NewFraction(0, 1)
+}
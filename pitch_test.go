@@ -0,0 +1,79 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPitch(t *testing.T) {
+	for _, c := range []struct {
+		key   string
+		body  string
+		notes string
+	}{
+		{"C", "C c c' C, =C", "C4/60 C5/72 C6/84 C3/48 C4/60"},
+		{"G", "F f =F", "F#4/66 F#5/78 F4/65"},
+		{"F", "B ^B =B", "Bb4/70 B#4/72 B4/71"},
+		{"Hp", "f c g", "F#5/78 C#5/73 G5/79"},
+		{"D exp _b", "f b", "F5/77 Bb5/82"},
+		{"C", "^F F f|F", "F#4/66 F#4/66 F5/77 F4/65"},
+		{"C", "_B B ^^C C|__D", "Bb4/70 Bb4/70 C##4/62 C##4/62 Dbb4/60"},
+		{"G", "=F F|F", "F4/65 F4/65 F#4/66"},
+		{"C transpose=-2", "c C", "A#4/70 A#3/58"},
+		{"C octave=-1", "c ^c", "C4/60 C#4/61"},
+		{"C t=12", "c", "C6/84"},
+		//half semitones are rounded away from the written pitch.
+		{"C", "^/c _/c _3/2c ^3/2c", "C#5/73 Cb5/71 Cbb5/70 C##5/74"},
+	} {
+		tune, _ := decodeTune(t, "X:1\nT:t\nK:"+c.key+"\n"+c.body+"|\n", false)
+		var notes []string
+		for _, m := range tune.Measures {
+			for _, ng := range m.NoteGroups {
+				for _, u := range ng.Units {
+					if n, ok := u.(*Note); ok {
+						notes = append(notes, n.PitchName()+"/"+strconv.Itoa(n.MIDI()))
+					}
+				}
+			}
+		}
+		if got := strings.Join(notes, " "); got != c.notes {
+			t.Errorf("K:%s %q: got %s, want %s", c.key, c.body, got, c.notes)
+		}
+	}
+}
+
+func TestAccidental(t *testing.T) {
+	for _, c := range []struct {
+		written   string
+		semitones string
+	}{
+		{"^", "1"},
+		{"^^", "2"},
+		{"_", "-1"},
+		{"__", "-2"},
+		{"=", "0"},
+		{"^/", "1/2"},
+		{"_/", "-1/2"},
+		{"^3/2", "3/2"},
+		{"_3/2", "-3/2"},
+		{"^1/4", "1/4"},
+	} {
+		accidental, err := parseAccidental(c.written)
+		if err != nil {
+			t.Errorf("%q: %v", c.written, err)
+			continue
+		}
+		if got := accidental.Semitones.String(); got != c.semitones {
+			t.Errorf("%q: got %s semitones, want %s", c.written, got, c.semitones)
+		}
+		if got := accidental.String(); got != c.written {
+			t.Errorf("%q: written as %q", c.written, got)
+		}
+	}
+	for _, written := range []string{"^_", "^/0", "^x/2", "~"} {
+		if _, err := parseAccidental(written); err == nil {
+			t.Errorf("%q: no error", written)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package abc
+
+import (
+	"bufio"
+	"unicode/utf8"
+)
+
+//position is a location in the ABC file.
+//The line and column start at 1, the column counts characters rather than bytes.
+type position struct {
+	line   int
+	column int
+	offset int64
+}
+
+//advance moves the position past byte b.
+func (p *position) advance(b byte) {
+	p.offset++
+	if b == '\n' {
+		p.line++
+		p.column = 1
+	} else if !utf8.RuneStart(b) {
+		//continuation bytes of a character do not move the column
+	} else {
+		p.column++
+	}
+}
+
+//positionReader is a bufio.Reader that keeps track of the position of the next byte,
+//so that diagnostics can point at the place where they occurred.
+type positionReader struct {
+	*bufio.Reader
+	pos  position
+	last position //position before the last byte or rune read, used when unreading.
+}
+
+func newPositionReader(r *bufio.Reader) *positionReader {
+	return &positionReader{Reader: r, pos: position{line: 1, column: 1}}
+}
+
+//ReadByte reads a single byte.
+func (r *positionReader) ReadByte() (byte, error) {
+	b, err := r.Reader.ReadByte()
+	if err == nil {
+		r.last = r.pos
+		r.pos.advance(b)
+	}
+	return b, err
+}
+
+//UnreadByte unreads the last byte.
+func (r *positionReader) UnreadByte() error {
+	err := r.Reader.UnreadByte()
+	if err == nil {
+		r.pos = r.last
+	}
+	return err
+}
+
+//ReadRune reads a single UTF-8 encoded character.
+func (r *positionReader) ReadRune() (rune, int, error) {
+	c, size, err := r.Reader.ReadRune()
+	if err == nil {
+		r.last = r.pos
+		r.pos.offset += int64(size)
+		if c == '\n' {
+			r.pos.line++
+			r.pos.column = 1
+		} else {
+			r.pos.column++
+		}
+	}
+	return c, size, err
+}
+
+//peekRune returns the next character without reading it.
+func (r *positionReader) peekRune() rune {
+	b, _ := r.Peek(utf8.UTFMax)
+	c, _ := utf8.DecodeRune(b)
+	return c
+}
+
+//UnreadRune unreads the last character.
+func (r *positionReader) UnreadRune() error {
+	err := r.Reader.UnreadRune()
+	if err == nil {
+		r.pos = r.last
+	}
+	return err
+}
+
+//ReadBytes reads up to and including delim.
+func (r *positionReader) ReadBytes(delim byte) ([]byte, error) {
+	b, err := r.Reader.ReadBytes(delim)
+	for i := range b {
+		r.last = r.pos
+		r.pos.advance(b[i])
+	}
+	return b, err
+}
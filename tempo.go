@@ -0,0 +1,99 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Tempo is the tempo of a Q: field, like `1/4=120`, `1/4 3/8=60` or `"Allegro" 1/4=120`.
+type Tempo struct {
+	//Beats are the note lengths that make up one beat together, like 1/4 and 3/8 in "1/4 3/8=60".
+	//There are no beats in the deprecated form "Q:120", where the beat is the unit note length.
+	Beats []Fraction `json:"beats,omitempty"`
+	//BPM is the number of beats per minute.
+	BPM uint64 `json:"bpm,omitempty"`
+	//Text is the quoted text in front of the tempo, like "Allegro".
+	Text string `json:"text,omitempty"`
+	//TextAfter is the quoted text after the tempo.
+	TextAfter string `json:"textAfter,omitempty"`
+}
+
+//parseTempo reads the text of a Q: field.
+//tempo ::= [quoted, " "], [beat, {" ", beat}, "="], DIGIT+, [" ", quoted] | quoted;
+//beat ::= DIGIT+, "/", DIGIT+;
+func parseTempo(text string) (Tempo, error) {
+	tempo := Tempo{}
+	written := ""
+	for {
+		quote := strings.IndexByte(text, '"')
+		if quote == -1 {
+			written += text
+			break
+		}
+		end := strings.IndexByte(text[quote+1:], '"')
+		if end == -1 {
+			return tempo, errors.New("tempo text is not closed by '\"'")
+		}
+		written += text[:quote]
+		if strings.TrimSpace(written) == "" {
+			tempo.Text = text[quote+1 : quote+1+end]
+		} else {
+			tempo.TextAfter = text[quote+1 : quote+1+end]
+		}
+		text = text[quote+end+2:]
+	}
+
+	written = strings.TrimSpace(written)
+	if written == "" {
+		return tempo, nil
+	}
+	bpm := written
+	if equals := strings.IndexByte(written, '='); equals != -1 {
+		for _, beat := range strings.Fields(written[:equals]) {
+			length, err := parseFraction(beat)
+			if err != nil || length.Numerator <= 0 {
+				return tempo, errors.Errorf("beat %q not properly formatted", beat)
+			}
+			tempo.Beats = append(tempo.Beats, length)
+		}
+		bpm = strings.TrimSpace(written[equals+1:])
+	}
+	var err error
+	tempo.BPM, err = strconv.ParseUint(bpm, 10, 64)
+	return tempo, errors.Wrap(err, "beats per minute not properly formatted")
+}
+
+//Beat returns the length of one beat as a fraction of a whole note, which is the sum of the beats.
+//It is 0 if the tempo has no beats, in which case the beat is the unit note length.
+func (t *Tempo) Beat() Fraction {
+	beat := NewFraction(0, 1)
+	for _, length := range t.Beats {
+		beat = beat.Add(length)
+	}
+	return beat
+}
+
+//String returns the tempo as written in a Q: field.
+func (t *Tempo) String() string {
+	var words []string
+	if t.Text != "" {
+		words = append(words, `"`+t.Text+`"`)
+	}
+	if t.BPM != 0 {
+		bpm := strconv.FormatUint(t.BPM, 10)
+		if len(t.Beats) > 0 {
+			beats := make([]string, len(t.Beats))
+			for i, length := range t.Beats {
+				beats[i] = length.String()
+			}
+			bpm = strings.Join(beats, " ") + "=" + bpm
+		}
+		words = append(words, bpm)
+	}
+	if t.TextAfter != "" {
+		words = append(words, `"`+t.TextAfter+`"`)
+	}
+	return strings.Join(words, " ")
+}
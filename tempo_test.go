@@ -0,0 +1,56 @@
+package abc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTempo(t *testing.T) {
+	for _, c := range []struct {
+		in        string
+		beats     string
+		bpm       uint64
+		text      string
+		textAfter string
+		written   string
+	}{
+		{"1/4=120", "1/4", 120, "", "", "1/4=120"},
+		{"1/4 3/8=60", "1/4 3/8", 60, "", "", "1/4 3/8=60"},
+		{"\"Allegro\" 1/4=120", "1/4", 120, "Allegro", "", "\"Allegro\" 1/4=120"},
+		{"1/2=60 \"slow\"", "1/2", 60, "", "slow", "1/2=60 \"slow\""},
+		{"\"Andante\"", "", 0, "Andante", "", "\"Andante\""},
+		{"120", "", 120, "", "", "120"},
+	} {
+		tempo, err := parseTempo(c.in)
+		if err != nil {
+			t.Errorf("%q: %v", c.in, err)
+			continue
+		}
+		var beats []string
+		for _, beat := range tempo.Beats {
+			beats = append(beats, beat.String())
+		}
+		if got := strings.Join(beats, " "); got != c.beats || tempo.BPM != c.bpm || tempo.Text != c.text || tempo.TextAfter != c.textAfter {
+			t.Errorf("%q: got %+v", c.in, tempo)
+		}
+		if got := tempo.String(); got != c.written {
+			t.Errorf("%q: written as %q, want %q", c.in, got, c.written)
+		}
+	}
+	for _, in := range []string{"1/4=", "x=120", "0/4=120", "\"open", "fast"} {
+		if _, err := parseTempo(in); err == nil {
+			t.Errorf("%q: no error", in)
+		}
+	}
+}
+
+func TestTempoBeat(t *testing.T) {
+	tempo, _ := parseTempo("1/4 3/8=60")
+	if got := tempo.Beat().String(); got != "5/8" {
+		t.Errorf("got beat %s, want 5/8", got)
+	}
+	tempo, _ = parseTempo("120")
+	if got := tempo.Beat().String(); got != "0" {
+		t.Errorf("got beat %s for a legacy tempo, want 0", got)
+	}
+}
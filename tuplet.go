@@ -0,0 +1,116 @@
+package abc
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Tuplet plays P notes in the time of Q notes, for the next R notes, like a triplet "(3abc".
+//Start is the index of the first unit of the tuplet in the units of its notegroup.
+type Tuplet struct {
+	P     int `json:"p"`
+	Q     int `json:"q"`
+	R     int `json:"r"`
+	Start int `json:"start"`
+	//Notation is the tuplet as written, like "(3" or "(3:2:4".
+	Notation string `json:"notation,omitempty"`
+}
+
+//tupletState is a tuplet that the next notes are still part of.
+type tupletState struct {
+	scale     Fraction
+	remaining int
+}
+
+//defaultTupletQ returns the number of notes p notes are played in the time of, if it is not written.
+//For 5, 7 and 9 notes, it depends on whether the meter is compound, like 6/8 or 9/8.
+func defaultTupletQ(p int, meter *Meter) int {
+	switch p {
+	case 2, 4, 8:
+		return 3
+	case 3, 6:
+		return 2
+	}
+	if meter != nil && meter.Top() > 3 && meter.Top()%3 == 0 {
+		return 3
+	}
+	return 2
+}
+
+//readTuplet reads the start of a tuplet, of which the notes follow.
+//tuplet ::= '(', DIGIT+, [':', {DIGIT}, [':', {DIGIT}]];
+func (d *Decoder) readTuplet() (Tuplet, error) {
+	d.r.ReadByte() //skipping '('
+	tuplet := Tuplet{}
+	var numbers [3]int
+	var written [3]string
+	for i := 0; i < 3; i++ {
+		if i > 0 {
+			b, _ := d.r.Peek(1)
+			if len(b) == 0 || b[0] != ':' {
+				break
+			}
+			d.r.ReadByte()
+		}
+		written[i] = string(d.readDigits())
+		if written[i] != "" {
+			number, err := strconv.Atoi(written[i])
+			if err != nil || number == 0 {
+				return tuplet, errors.New("tuplet not properly formatted")
+			}
+			numbers[i] = number
+		}
+	}
+	if numbers[0] == 0 {
+		return tuplet, errors.New("tuplet has no number of notes")
+	}
+
+	tuplet.P, tuplet.Q, tuplet.R = numbers[0], numbers[1], numbers[2]
+	if tuplet.Q == 0 {
+		tuplet.Q = defaultTupletQ(tuplet.P, d.meter)
+	}
+	if tuplet.R == 0 {
+		tuplet.R = tuplet.P
+	}
+	tuplet.Notation = "(" + strings.TrimRight(strings.Join(written[:], ":"), ":")
+	return tuplet, nil
+}
+
+//state returns the tuplet as started before its first note.
+func (t *Tuplet) state() tupletState {
+	return tupletState{scale: NewFraction(int64(t.Q), int64(t.P)), remaining: t.R}
+}
+
+//nextTupletScale returns how much the duration of the next note, rest or chord is scaled by the tuplets,
+//and the tuplets that are still active after it.
+func nextTupletScale(tuplets []tupletState) (Fraction, []tupletState) {
+	scale := NewFraction(1, 1)
+	var active []tupletState
+	for _, tuplet := range tuplets {
+		scale = scale.Mul(tuplet.scale)
+		if tuplet.remaining--; tuplet.remaining > 0 {
+			active = append(active, tuplet)
+		}
+	}
+	return scale, active
+}
+
+//scaleTuplet scales the duration of a note, rest or chord that is part of the tuplets that were started.
+func (d *Decoder) scaleTuplet(unit Unit) {
+	if len(d.tuplets) == 0 {
+		return
+	}
+	var scale Fraction
+	scale, d.tuplets = nextTupletScale(d.tuplets)
+	unit.SetDuration(unit.GetDuration().Mul(scale))
+}
+
+//String returns the tuplet as written in front of its notes.
+func (t *Tuplet) String() string {
+	if t.Notation != "" {
+		return t.Notation
+	}
+	return "(" + strconv.Itoa(t.P) + ":" + strconv.Itoa(t.Q) + ":" + strconv.Itoa(t.R)
+}
@@ -0,0 +1,62 @@
+package abc
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTuplet(t *testing.T) {
+	for _, c := range []struct {
+		meter     string
+		body      string
+		tuplet    string
+		durations string
+	}{
+		{"4/4", "(3abc d", "3:2:3", "2/3 2/3 2/3 1"},
+		{"4/4", "(2ab c", "2:3:2", "3/2 3/2 1"},
+		{"4/4", "(5abcde f", "5:2:5", "2/5 2/5 2/5 2/5 2/5 1"},
+		{"6/8", "(5abcde f", "5:3:5", "3/5 3/5 3/5 3/5 3/5 1"},
+		{"3/4", "(5abcde f", "5:2:5", "2/5 2/5 2/5 2/5 2/5 1"},
+		{"4/4", "(3:2:4abcd e", "3:2:4", "2/3 2/3 2/3 2/3 1"},
+		{"4/4", "(3::2a2b c", "3:2:2", "4/3 2/3 1"},
+		{"4/4", "(3[ceg]ab c", "3:2:3", "2/3 2/3 2/3 1"},
+		{"4/4", "(3a>bc d", "3:2:3", "1 1/3 2/3 1"},
+	} {
+		tune, _ := decodeTune(t, "X:1\nT:t\nM:"+c.meter+"\nL:1/8\nK:C\n"+c.body+"|\n", false)
+		ng := tune.Measures[0].NoteGroups[0]
+		if len(ng.Tuplets) != 1 {
+			t.Errorf("%q: got tuplets %v", c.body, ng.Tuplets)
+			continue
+		}
+		tuplet := ng.Tuplets[0]
+		if got := fmt.Sprintf("%d:%d:%d", tuplet.P, tuplet.Q, tuplet.R); got != c.tuplet {
+			t.Errorf("%q: got tuplet %s, want %s", c.body, got, c.tuplet)
+		}
+		var durations []string
+		for _, group := range tune.Measures[0].NoteGroups {
+			for _, u := range group.Units {
+				durations = append(durations, u.GetDuration().String())
+			}
+		}
+		if got := strings.Join(durations, " "); got != c.durations {
+			t.Errorf("%q: got durations %s, want %s", c.body, got, c.durations)
+		}
+	}
+}
+
+func TestTupletChord(t *testing.T) {
+	tune, _ := decodeTune(t, "X:1\nT:t\nL:1/8\nK:C\n(3[ce]2ab|\n", false)
+	chord, ok := tune.Measures[0].NoteGroups[0].Units[0].(*Chord)
+	if !ok {
+		t.Fatalf("got %v", tune.Measures[0].NoteGroups[0].Units)
+	}
+	for _, note := range chord.Notes() {
+		if note.Duration.String() != "4/3" {
+			t.Errorf("note %s of the chord lasts %s", note.Value, note.Duration)
+		}
+	}
+	if chord.Duration.String() != "4/3" {
+		t.Errorf("chord lasts %s", chord.Duration)
+	}
+}
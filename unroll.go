@@ -0,0 +1,199 @@
+package abc
+
+import "strings"
+
+//Unroll returns the measures of the tune in the order they are played, following the part order
+//in the tune header, the repeats and endings, and the D.C., D.S., fine and coda decorations.
+//The measures of a voice are unrolled with t.Parts.Unroll.
+func (t *Tune) Unroll() []Measure {
+	return t.Parts.Unroll(t.Measures)
+}
+
+//Unroll returns the measures in the order they are played. Each part is unrolled on its own,
+//after which the parts are put in the part order as with Expand.
+func (o PartOrder) Unroll(measures []Measure) []Measure {
+	if len(o) == 0 {
+		return unrollRepeats(measures)
+	}
+	sections := namedSections(measures)
+	var unrolled []Measure
+	for _, name := range o.Names() {
+		unrolled = append(unrolled, unrollRepeats(sections[name])...)
+	}
+	return unrolled
+}
+
+//unrollRepeats returns the measures in the order they are played.
+//A repeat starts at the last "|:", after the last repeat or double barline, or at the start.
+//Once the last ending is reached, a repeat after it starts at that ending.
+//After a jump to the start or the segno, repeats are not played again and only the last endings are played.
+func unrollRepeats(measures []Measure) []Measure {
+	var played []Measure
+	//ending is the pass that chooses the endings, which continues after the last ending
+	//while pass starts again for a repeat that follows it.
+	start, pass, ending := 0, 1, 1
+	jumped := false
+	for i := 0; i < len(measures); {
+		m := &measures[i]
+		if m.RepeatStart && start != i {
+			start, pass, ending = i, 1, 1
+		}
+		if m.Ending != nil && !playsEnding(measures, i, ending, jumped) {
+			next := skipEnding(measures, i)
+			if measures[next-1].RepeatEnd && next < len(measures) && measures[next].Ending != nil && lastEnding(measures, next) {
+				start, pass = next, 1
+			}
+			i = next
+			continue
+		}
+		played = append(played, *m)
+
+		navigation := navigations(m)
+		if jumped && navigation["fine"] {
+			break
+		}
+		if jumped && (navigation["coda"] || navigation["dacoda"]) {
+			if coda := findNavigation(measures, i+1, "coda"); coda != -1 {
+				i, start, pass, ending = coda, coda, 1, 1
+				continue
+			}
+		}
+		if m.RepeatEnd && !jumped && pass < repeats(measures, start, i) {
+			i, pass, ending = start, pass+1, pass+1
+			continue
+		}
+		if m.RepeatEnd || m.ThickEnd || (i+1 < len(measures) && (measures[i+1].BarlineStart || measures[i+1].ThickStart)) {
+			start, pass, ending = i+1, 1, 1
+		}
+		if !jumped {
+			switch {
+			case navigation["D.C."] || navigation["dacapo"] || navigation["D.C.alcoda"] || navigation["D.C.alfine"]:
+				i, start, pass, ending, jumped = 0, 0, 1, 1, true
+				continue
+			case navigation["D.S."] || navigation["D.S.alcoda"] || navigation["D.S.alfine"]:
+				segno := findNavigation(measures, 0, "segno")
+				if segno == -1 {
+					segno = 0
+				}
+				i, start, pass, ending, jumped = segno, segno, 1, 1, true
+				continue
+			}
+		}
+		i++
+	}
+	return played
+}
+
+//playsEnding checks whether the ending that starts at measure i is played in the pass of the repeat.
+//After a jump to the start or the segno, only the last ending is played.
+func playsEnding(measures []Measure, i int, pass int, jumped bool) bool {
+	if !jumped {
+		for _, number := range measures[i].Ending {
+			if number == pass {
+				return true
+			}
+		}
+		return false
+	}
+	return lastEnding(measures, i)
+}
+
+//lastEnding checks whether the ending that starts at measure i is the last one of its repeat.
+func lastEnding(measures []Measure, i int) bool {
+	for j := i + 1; j < len(measures) && !startsSection(&measures[j]); j++ {
+		if measures[j].Ending != nil {
+			return false
+		}
+	}
+	return true
+}
+
+//skipEnding returns the measure after the ending that starts at measure i.
+//The ending lasts up to the next ending, or up to and including the end of the repeat.
+func skipEnding(measures []Measure, i int) int {
+	for j := i; ; j++ {
+		if measures[j].RepeatEnd || measures[j].ThickEnd {
+			return j + 1
+		}
+		if j+1 == len(measures) || measures[j+1].Ending != nil || startsSection(&measures[j+1]) {
+			return j + 1
+		}
+	}
+}
+
+//startsSection checks whether a measure starts a new part of the music, after "|:", "||" or "[|".
+func startsSection(m *Measure) bool {
+	return m.RepeatStart || m.BarlineStart || m.ThickStart
+}
+
+//repeats returns how many times the repeat from measure start up to measure end is played.
+//It is twice, or once more than the number of ':' in front of a barline like "::|",
+//unless the endings are numbered higher.
+func repeats(measures []Measure, start, end int) int {
+	times := 2
+	if end+1 < len(measures) {
+		barline := measures[end+1].Barline
+		colons := len(barline) - len(strings.TrimLeft(barline, ":"))
+		if colons > 1 && strings.HasPrefix(barline[colons:], "|") {
+			times = colons + 1
+		}
+	}
+	for j := start; j < len(measures); j++ {
+		if j > end && startsSection(&measures[j]) {
+			break
+		}
+		for _, number := range measures[j].Ending {
+			if number > times {
+				times = number
+			}
+		}
+	}
+	return times
+}
+
+//navigations returns the names of the D.C., D.S., fine, segno and coda decorations in a measure
+//and on the barline that ends it.
+func navigations(m *Measure) map[string]bool {
+	names := map[string]bool{}
+	for _, decoration := range m.Decorations {
+		names[decoration.Name] = true
+	}
+	for _, ng := range m.NoteGroups {
+		for _, u := range ng.Units {
+			if a, ok := u.(attacher); ok {
+				for _, decoration := range a.attached().Decorations {
+					names[decoration.Name] = true
+				}
+			}
+		}
+	}
+	return names
+}
+
+//findNavigation returns the measure that starts at a decoration like the segno, from measure from on.
+//A decoration on a barline is at the start of the measure after it. It returns -1 if there is none.
+func findNavigation(measures []Measure, from int, name string) int {
+	for j := from; j < len(measures); j++ {
+		for _, ng := range measures[j].NoteGroups {
+			for _, u := range ng.Units {
+				if a, ok := u.(attacher); ok && hasDecoration(a.attached().Decorations, name) {
+					return j
+				}
+			}
+		}
+		if hasDecoration(measures[j].Decorations, name) && j+1 < len(measures) {
+			return j + 1
+		}
+	}
+	return -1
+}
+
+//hasDecoration checks whether decorations has one with the given name.
+func hasDecoration(decorations []Decoration, name string) bool {
+	for _, decoration := range decorations {
+		if decoration.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package abc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnroll(t *testing.T) {
+	for _, c := range []struct {
+		parts string
+		body  string
+		want  string
+	}{
+		{"", "C|:D|E:|F|", "CDEDEF"},
+		{"", "C|D:|E|", "CDCDE"},
+		{"", "|:C|[1D:|[2E|F|", "CDCEF"},
+		{"", "|:C|[1D:|[2E|F|G:|", "CDCEFGEFG"},
+		{"", "|:C|1D:|2E|F|G:|", "CDCEFGEFG"},
+		{"", "|:C|[1D:|[2E:|[3F|G|", "CDCECFG"},
+		{"", "|:C|1D:|2E||F:|", "CDCEFF"},
+		{"", "|:C|[1,3D:|[2E:|[4F|", "CDCECDCF"},
+		{"", "|:C::D:|E|", "CCDDE"},
+		{"", "|:C::|D|", "CCCD"},
+		{"", "C|D!fine!|E|F!D.C.!|", "CDEFCD"},
+		{"", "C|SD|E|F!D.S.!|", "CDEFDEF"},
+		{"", "C!segno!|D|E!D.S.!|F|", "CDEDEF"},
+		{"", "C|SD|OE|F!D.S.alcoda!|OG|A|", "CDEFDEGA"},
+		{"", "|:C|[1D:|[2E|F!D.C.!|", "CDCEFCEF"},
+		{"P:ABA\n", "P:A\nC|D:|\nP:B\nE|F|", "CDCDEFCDCD"},
+	} {
+		tune, _ := decodeTune(t, "X:1\nT:unroll\n"+c.parts+"M:1/8\nL:1/8\nK:C\n"+c.body+"\n", false)
+		var sb strings.Builder
+		for _, m := range tune.Unroll() {
+			for _, ng := range m.NoteGroups {
+				for _, u := range ng.Units {
+					if _, isField := u.(*Field); !isField {
+						sb.WriteString(u.GetValue())
+					}
+				}
+			}
+		}
+		if got := sb.String(); got != c.want {
+			t.Errorf("%q: got %s, want %s", c.body, got, c.want)
+		}
+	}
+}
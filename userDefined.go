@@ -0,0 +1,69 @@
+package abc
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//UserSymbol is a single character that stands for a decoration or annotation, defined in a U: field
+//like "U:T = !trill!" or `U:W = "^text"`. It may redefine one of the default symbols.
+//A definition of "!nil!" or "!none!" makes the symbol stand for nothing.
+type UserSymbol struct {
+	//Symbol is '~' or a letter from H to W or h to w.
+	Symbol     string `json:"symbol"`
+	Definition string `json:"definition"`
+}
+
+//parseUserSymbol reads the text of a U: field.
+//userSymbol ::= ('~' | 'H'..'W' | 'h'..'w'), '=', (decoration | '+', {CHAR}, '+' | quoted);
+func parseUserSymbol(text string) (UserSymbol, error) {
+	equals := strings.IndexByte(text, '=')
+	if equals == -1 {
+		return UserSymbol{}, errors.New("user defined symbol has no '='")
+	}
+	symbol := UserSymbol{Symbol: strings.TrimSpace(text[:equals]), Definition: strings.TrimSpace(text[equals+1:])}
+	if len(symbol.Symbol) != 1 || !isUserSymbol(symbol.Symbol[0]) {
+		return symbol, errors.Errorf("%q can not be a user defined symbol", symbol.Symbol)
+	}
+	definition := symbol.Definition
+	if len(definition) < 2 || strings.IndexByte(`!+"`, definition[0]) == -1 || definition[len(definition)-1] != definition[0] {
+		return symbol, errors.Errorf("definition %q is not a decoration or quoted text", definition)
+	}
+	return symbol, nil
+}
+
+//isUserSymbol checks whether a character can be defined as a symbol.
+func isUserSymbol(b byte) bool {
+	return b == '~' || (b >= 'H' && b <= 'W') || (b >= 'h' && b <= 'w')
+}
+
+//String returns the symbol and its definition as written in a U: field.
+func (s UserSymbol) String() string {
+	return s.Symbol + " = " + s.Definition
+}
+
+//defineSymbol makes a symbol stand for its definition in the music that follows.
+func (d *Decoder) defineSymbol(symbol UserSymbol) {
+	d.symbols[symbol.Symbol[0]] = symbol.Definition
+}
+
+//readUserSymbol reads the text of a U: field and defines its symbol.
+//In the file header, it holds for every tune in the file.
+func (d *Decoder) readUserSymbol(line string, inline bool) error {
+	symbol, err := parseUserSymbol(line)
+	if err != nil {
+		return err
+	}
+	switch {
+	case d.inFileHeader:
+		d.UserDefined = append(d.UserDefined, symbol)
+		return nil
+	case !d.tuneHeaderDone:
+		d.tune.UserDefined = append(d.tune.UserDefined, symbol)
+	default:
+		d.addUnit(&Field{Name: "U", Value: line, Line: !inline})
+	}
+	d.defineSymbol(symbol)
+	return nil
+}
@@ -0,0 +1,192 @@
+package abc
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//Voice is one voice of a tune with several voices, like the tenor in a choir or the accompaniment of a melody.
+//It is defined by a V: field like `V:T1 name="Tenor I" snm="T.I" clef=treble-8`, either in the tune header
+//or in the tune body, where it also switches the music that follows to the voice.
+type Voice struct {
+	ID string `json:"id"`
+	//Name is printed in front of the first staff of the voice, Subname in front of the others.
+	Name    string `json:"name,omitempty"`
+	Subname string `json:"subname,omitempty"`
+	//Stem is "up" or "down" if the direction of all note stems is forced.
+	Stem string `json:"stem,omitempty"`
+	Staff
+	Measures []Measure `json:"measures,omitempty"`
+}
+
+//parseVoice reads the text of a V: field.
+//voice ::= ID, {" ", voiceProperty};
+//voiceProperty ::= ("name=" | "nm=" | "subname=" | "snm=") , (text | quoted) | "stem=", ("up" | "down") | modifier;
+func parseVoice(text string) (Voice, error) {
+	words := splitWords(text)
+	if len(words) == 0 {
+		return Voice{}, errors.New("voice has no ID")
+	}
+	voice := Voice{ID: words[0]}
+	for _, word := range words[1:] {
+		name, value := word, ""
+		if i := strings.IndexByte(word, '='); i != -1 {
+			name, value = word[:i], strings.Trim(word[i+1:], `"`)
+		}
+		switch name {
+		case "name", "nm":
+			voice.Name = value
+		case "subname", "sname", "snm":
+			voice.Subname = value
+		case "stem":
+			voice.Stem = value
+		default:
+			if _, err := voice.Staff.parseModifier(word); err != nil {
+				return voice, err
+			}
+		}
+	}
+	return voice, nil
+}
+
+//splitWords splits text at spaces, except for the spaces between double quotes.
+func splitWords(text string) []string {
+	var words []string
+	word := ""
+	quoted := false
+	for _, r := range text {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			word += string(r)
+		case !quoted && (r == ' ' || r == '\t'):
+			if word != "" {
+				words = append(words, word)
+			}
+			word = ""
+		default:
+			word += string(r)
+		}
+	}
+	if word != "" {
+		words = append(words, word)
+	}
+	return words
+}
+
+//merge copies the properties that are set in other to the voice.
+func (v *Voice) merge(other *Voice) {
+	if other.Name != "" {
+		v.Name = other.Name
+	}
+	if other.Subname != "" {
+		v.Subname = other.Subname
+	}
+	if other.Stem != "" {
+		v.Stem = other.Stem
+	}
+	if other.Clef != "" {
+		v.Clef = other.Clef
+	}
+	if other.Transpose != 0 {
+		v.Transpose = other.Transpose
+	}
+	if other.Octave != 0 {
+		v.Octave = other.Octave
+	}
+	if other.Middle != "" {
+		v.Middle = other.Middle
+	}
+}
+
+//definition returns the voice as written in a V: field in the tune header.
+func (v *Voice) definition() string {
+	words := []string{v.ID}
+	if v.Name != "" {
+		words = append(words, `name="`+v.Name+`"`)
+	}
+	if v.Subname != "" {
+		words = append(words, `subname="`+v.Subname+`"`)
+	}
+	if v.Stem != "" {
+		words = append(words, "stem="+v.Stem)
+	}
+	words = append(words, v.modifiers()...)
+	return strings.Join(words, " ")
+}
+
+//Voice returns the voice with the given ID, or nil if the tune has no such voice.
+func (t *Tune) Voice(id string) *Voice {
+	for i := range t.Voices {
+		if t.Voices[i].ID == id {
+			return &t.Voices[i]
+		}
+	}
+	return nil
+}
+
+//voiceState is the state of the decoder that each voice has of its own, as a change of key, unit note length
+//or meter in the tune body only holds for the voice it is in. Notes may still be tied to the next note of the voice.
+type voiceState struct {
+	brokenRhythm   *Fraction           //factor for the duration of the note after '<' or '>'
+	unitNoteLength Fraction            //unit note length at the current position in the tune body
+	meter          *Meter              //meter at the current position in the tune body, nil for free meter
+	attached       Attached            //attached to the next note, rest or chord
+	ties           []*Note             //notes that are tied to the next note of the same pitch
+	tuplets        []tupletState       //tuplets the next notes are part of
+	signature      map[string]Fraction //alteration of each note letter in the current key
+	transpose      int                 //semitones the music sounds higher than written
+	barAccidentals map[string]Fraction //accidentals in the current bar, by note letter and octave
+}
+
+//tuneHeaderState returns the state a voice starts in, following from the fields in the tune header.
+func (d *Decoder) tuneHeaderState() voiceState {
+	state := voiceState{
+		unitNoteLength: d.tune.UnitNoteLength,
+		meter:          d.tune.Meter,
+		signature:      map[string]Fraction{},
+		transpose:      d.tune.Key.semitones(),
+		barAccidentals: map[string]Fraction{},
+	}
+	if d.tune.Key.HasSignature() {
+		state.signature = d.tune.Key.Signature()
+	}
+	return state
+}
+
+//setVoice defines voice v or changes the properties of an earlier definition.
+//In the tune body, the music that follows is added to the voice.
+func (d *Decoder) setVoice(v *Voice) {
+	voice := d.tune.Voice(v.ID)
+	if voice == nil {
+		d.tune.Voices = append(d.tune.Voices, Voice{ID: v.ID})
+		voice = &d.tune.Voices[len(d.tune.Voices)-1]
+	}
+	voice.merge(v)
+	if !d.tuneHeaderDone {
+		return
+	}
+	if voice.Measures == nil {
+		//initializing the first measure with one notegroup, like the tune body.
+		voice.Measures = make([]Measure, 1)
+		voice.Measures[0].NoteGroups = make([]NoteGroup, 1)
+	}
+	//the voice continues where it was left, or starts as in the tune header.
+	d.voiceStates[d.voice] = d.voiceState
+	d.voice = voice.ID
+	state, ok := d.voiceStates[voice.ID]
+	if !ok {
+		state = d.tuneHeaderState()
+	}
+	d.voiceState = state
+}
+
+//measures returns the measures of the voice that is being decoded,
+//which are those of the tune itself for music that is not in a voice.
+func (d *Decoder) measures() *[]Measure {
+	if voice := d.tune.Voice(d.voice); voice != nil {
+		return &voice.Measures
+	}
+	return &d.tune.Measures
+}